@@ -1,34 +1,78 @@
 package bot
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 )
 
 type Bot struct {
 	Bot            *tgbotapi.BotAPI
-	allEvents      []EventInformation         // 全部活动
-	onEvent        []EventInformation         // 正在进行的活动
-	cancelEvents   []EventInformation         // 取消的活动
-	userJoinEvents []EventInformation         //用户参与过的所有活动信息
-	winInfoList    []winInfo                  //用户的中奖信息
-	prizeList      []string                   //奖品列表
+	store          Store                      // 数据存取，运行期间共用同一个数据库连接池
 	UserStates     map[int64]string           // 用于跟踪用户的状态
 	userStatesMu   sync.Mutex                 // 用于保护 UserStates 的并发访问
 	EventInfoMap   map[int64]EventInformation // 用于暂存创建的活动信息
 	eventInfoMapMu sync.Mutex                 // 用于保护 EventInfoMap 的并发访问
 	drawTimers     map[string]*time.Timer     // 用于管理开奖的定时任务
 	timersMu       sync.Mutex                 // 用于保护 drawTimers 的并发访问
+	drawMu         sync.Mutex                 // 保证同一时间只执行一个开奖事务
+	groups         []lotteryGroup             // 配置的抽奖群，第一个为默认群组
+	announceTexts  map[string]string          // 活动公告最后一次发送的内容，内容未变化时不编辑
+	announceMu     sync.Mutex                 // 用于保护 announceTexts 的并发访问
+	stopMu         sync.Mutex                 // 用于保护 stopping 的并发访问
+	stopping       bool                       // 是否正在停止，停止后不再开始新的开奖和 webhook 服务
+	inflight       sync.WaitGroup             // 正在进行的开奖、中奖通知和公告刷新
+	stopCh         chan struct{}              // 停止时关闭，通知后台任务退出
+	updatesDone    chan struct{}              // 更新处理循环退出时关闭
+	webhookServer  *http.Server               // webhook 模式下的 HTTP 服务，由 stopMu 保护
 }
 
+// 停止时等待进行中的任务完成的最长时间
+const shutdownTimeout = 30 * time.Second
+
 func NewBot() (*Bot, error) {
 	readConfig() //加载配置文件
-	botInstance, err := tgbotapi.NewBotAPI(config.ApiToken)
+
+	// 打开数据库，运行期间所有指令共用此连接
+	store, err := openStore()
 	if err != nil {
 		return nil, err
 	}
+	closeStore := func() {
+		if err := store.Close(); err != nil {
+			log.Printf("close db err: %v", err)
+		}
+	}
+
+	// 导入旧版本奖品文件中的奖品
+	err = importPrizesFromTxtFile(store)
+	if err != nil {
+		closeStore()
+		return nil, fmt.Errorf("import prizes error: %v", err)
+	}
+
+	// 恢复重启前未完成的创建活动向导
+	userStates, eventInfoMap, err := store.LoadWizardStates()
+	if err != nil {
+		closeStore()
+		return nil, fmt.Errorf("load wizard states error: %v", err)
+	}
+
+	// 可指定 Bot API 地址，例如自建的 Bot API 服务或本地的测试服务器
+	apiEndpoint := tgbotapi.APIEndpoint
+	if config.APIEndpoint != "" {
+		apiEndpoint = config.APIEndpoint
+	}
+	botInstance, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.ApiToken, apiEndpoint)
+	if err != nil {
+		closeStore()
+		return nil, err
+	}
 	// 设置命令列表
 	commands := []tgbotapi.BotCommand{
 		{Command: "id", Description: "查看你自己的用户ID"},
@@ -36,6 +80,7 @@ func NewBot() (*Bot, error) {
 		{Command: "see", Description: "查看已参与的活动"},
 		{Command: "join", Description: "参加抽奖活动"},
 		{Command: "prize", Description: "查看中奖历史信息"},
+		{Command: "verify", Description: "复算并验证活动的开奖结果"},
 	}
 
 	// 设置命令到 Telegram 服务器
@@ -44,10 +89,21 @@ func NewBot() (*Bot, error) {
 		log.Fatalf("Failed to set commands: %v", err)
 	}
 	bot := &Bot{
-		Bot:          botInstance,
-		drawTimers:   make(map[string]*time.Timer),
-		UserStates:   make(map[int64]string),
-		EventInfoMap: make(map[int64]EventInformation),
+		Bot:           botInstance,
+		store:         store,
+		drawTimers:    make(map[string]*time.Timer),
+		UserStates:    userStates,
+		EventInfoMap:  eventInfoMap,
+		announceTexts: make(map[string]string),
+		stopCh:        make(chan struct{}),
+		updatesDone:   make(chan struct{}),
+	}
+
+	// 获取配置的抽奖群信息
+	err = bot.loadGroups()
+	if err != nil {
+		closeStore()
+		return nil, err
 	}
 
 	return bot, nil
@@ -55,9 +111,28 @@ func NewBot() (*Bot, error) {
 
 func (b *Bot) Start() {
 	log.Println("Bot started...")
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := b.Bot.GetUpdatesChan(u)
+	defer close(b.updatesDone)
+
+	// 配置了 webhook 时由内置的 HTTP 服务接收更新，否则使用长轮询
+	var updates tgbotapi.UpdatesChannel
+	if config.Webhook.Enabled {
+		var err error
+		updates, err = b.startWebhook()
+		if errors.Is(err, errBotStopping) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to start webhook: %v", err)
+		}
+	} else {
+		// 清除之前设置的 webhook，否则无法使用长轮询
+		if _, err := b.Bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("Failed to delete webhook: %v", err)
+		}
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+		updates = b.Bot.GetUpdatesChan(u)
+	}
 
 	// 刷新开奖时间定时器
 	err := b.regularPrizeDraw()
@@ -65,32 +140,128 @@ func (b *Bot) Start() {
 		log.Printf("Failed to regular prize draw: %v", err)
 	}
 
-	for update := range updates {
-		// 检查 Bot 是否已经初始化
-		if b.Bot == nil {
-			log.Println("Bot is nil, skipping update handling.")
-			continue
+	// 定时更新活动公告中的参与人数和开奖倒计时
+	go b.announcementLoop()
+
+	// 定时将逾期未领取的奖品递补给候补
+	go b.claimLoop()
+
+	for {
+		select {
+		case <-b.stopCh:
+			log.Println("Stopped receiving updates.")
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			b.processUpdate(update)
+		}
+	}
+}
+
+// 分发收到的更新，长轮询和 webhook 共用
+func (b *Bot) processUpdate(update tgbotapi.Update) {
+	// 检查 Bot 是否已经初始化
+	if b.Bot == nil {
+		log.Println("Bot is nil, skipping update handling.")
+		return
+	}
+
+	if update.Message != nil {
+		// 处理命令
+		b.handleUpdate(update.Message)
+
+		// 以 /weights 活动ID 为说明发送的 CSV 文件，导入参与者的抽奖次数
+		if update.Message.Document != nil && captionCommand(update.Message) == "weights" {
+			err := b.cmdWeights(update.Message)
+			if err != nil {
+				log.Printf("cmdWeights failed: %v", err)
+			}
 		}
 
-		if update.Message != nil {
-			// 处理命令
-			b.handleUpdate(update.Message)
+		// 统计抽奖群中的消息数量，用于活跃奖励
+		if !update.Message.Chat.IsPrivate() && !update.Message.IsCommand() {
+			b.countGroupMessage(update.Message)
+		}
 
-			// 检查消息是否为 nil，并且不是命令
-			if update.Message.Text != "" && !update.Message.IsCommand() {
-				err := b.listenKeyWordMsg(update.Message)
-				if err != nil {
-					log.Printf("Failed to handle text message: %v", err)
-				}
+		// 检查消息是否为 nil，并且不是命令
+		if update.Message.Text != "" && !update.Message.IsCommand() {
+			// 私聊中正在使用创建向导时，消息作为向导的输入
+			handled, err := b.handleWizardInput(update.Message)
+			if err != nil {
+				log.Printf("Failed to handle wizard input: %v", err)
+			}
+			if handled {
+				return
+			}
+			err = b.listenKeyWordMsg(update.Message)
+			if err != nil {
+				log.Printf("Failed to handle text message: %v", err)
 			}
-		} else if update.CallbackQuery != nil {
-			// 处理回调查询
-			b.handleCallbackQuery(update.CallbackQuery)
 		}
+	} else if update.CallbackQuery != nil {
+		// 处理回调查询
+		b.handleCallbackQuery(update.CallbackQuery)
 	}
+}
 
+// 登记一个进行中的任务，正在停止时返回 false
+func (b *Bot) beginWork() bool {
+	b.stopMu.Lock()
+	defer b.stopMu.Unlock()
+	if b.stopping {
+		return false
+	}
+	b.inflight.Add(1)
+	return true
 }
 
+// Stop 停止接收更新和开奖定时任务，并等待进行中的开奖、中奖通知和公告刷新完成，重复调用时直接返回
 func (b *Bot) Stop() {
-	log.Println("Bot stopped.")
+	b.stopMu.Lock()
+	if b.stopping {
+		b.stopMu.Unlock()
+		return
+	}
+	b.stopping = true
+	// webhookServer 在同一把锁下设置，此后不会再启动 webhook 服务
+	webhookServer := b.webhookServer
+	b.stopMu.Unlock()
+	close(b.stopCh)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// 停止接收更新
+	if webhookServer != nil {
+		if err := webhookServer.Shutdown(ctx); err != nil {
+			log.Printf("webhook server shutdown error: %v", err)
+		}
+	} else if !config.Webhook.Enabled {
+		b.Bot.StopReceivingUpdates()
+	}
+
+	// 停止尚未触发的开奖定时任务，停机期间到期的活动在下次启动时补开奖
+	b.stopDrawTimers()
+
+	// 等待正在处理的更新以及进行中的开奖、中奖通知和公告刷新
+	done := make(chan struct{})
+	go func() {
+		<-b.updatesDone
+		b.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("Bot stopped.")
+	case <-ctx.Done():
+		log.Println("Bot stopped: timed out waiting for in-flight draws.")
+		// 仍在进行的任务可能还会访问数据库，此时不关闭连接，由进程退出时释放
+		return
+	}
+
+	if err := b.store.Close(); err != nil {
+		log.Printf("close db err: %v", err)
+	}
 }
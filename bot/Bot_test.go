@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+// closeCountingStore 记录 Close 被调用的次数
+type closeCountingStore struct {
+	Store
+	closed int
+}
+
+func (s *closeCountingStore) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestStopTwice(t *testing.T) {
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+	store := &closeCountingStore{}
+	b.store = store
+	b.drawTimers = make(map[string]*time.Timer)
+	b.updatesDone = make(chan struct{})
+	close(b.updatesDone)
+
+	b.Stop()
+	b.Stop()
+	if store.closed != 1 {
+		t.Errorf("store closed %d times, want 1", store.closed)
+	}
+}
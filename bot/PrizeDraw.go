@@ -1,187 +1,434 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
-	"math/rand"
 	"time"
 )
 
+var (
+	errEventCanceled            = errors.New("活动已取消，取消开奖")
+	errEventAlreadyOpened       = errors.New("活动已经开奖，跳过")
+	errInsufficientParticipants = errors.New("参与者数量不足，无法开奖,活动已取消")
+	errDrawExtended             = errors.New("参与者数量不足，开奖时间已延长")
+	errBotStopping              = errors.New("机器人正在停止，暂停开奖")
+	errEventClosed              = errors.New("活动已结束，无法参与")
+	errEventIDExists            = errors.New("活动ID已存在")
+)
+
 // 执行开奖操作
 func (b *Bot) prizeDraw(eventID string) error {
-	// 初始化数据库
-	db, err := initDB()
+	// 停机过程中不再开始新的开奖，未开奖的活动在下次启动时由 regularPrizeDraw 补开奖
+	if !b.beginWork() {
+		return fmt.Errorf("活动ID %v: %w", eventID, errBotStopping)
+	}
+	defer b.inflight.Done()
+
+	// 开奖前再次检查参与条件，需要调用 Telegram 接口，因此在开奖事务之外进行
+	eventInfo, err := b.store.GetEvent(eventID)
 	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
 		return err
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
+	var vips map[int64]bool
+	var missing map[int64]string
+	if !eventInfo.OpenStatus && !eventInfo.CancelStatus {
+		missing, err = b.recheckEligibility(eventInfo)
+		if err != nil {
+			log.Printf("recheckEligibility: %v", err)
+			return err
+		}
+		// 抽奖群管理员享有 VIP 倍数，同样需要调用 Telegram 接口
+		vips, err = b.loadVIPs(eventInfo)
+		if err != nil {
+			log.Printf("活动ID %s 无法获取抽奖群管理员，只使用配置的 VIP 名单: %v", eventID, err)
+		}
+	}
+
+	// 在同一事务中完成抽取中奖者、保存中奖信息、发放奖品和修改开奖状态
+	eventInfo, excluded, err := b.drawWinners(eventID, vips, missing)
+	if errors.Is(err, errInsufficientParticipants) {
+		b.stopDrawTimer(eventID)
+		b.finishAnnouncement(eventInfo, "❌ <b>参与人数不足，活动已取消</b>")
+	}
+	if errors.Is(err, errDrawExtended) {
+		// 按新的开奖时间重新设定定时任务，公告中的开奖时间由 announcementLoop 刷新
+		b.rescheduleDraw(eventInfo)
+		notice := fmt.Sprintf("⏳ 活动 %s 参与人数不足 %d 人，开奖时间延长至 %s %s",
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeName), minParticipants(eventInfo), eventInfo.TimeOfWinners, config.TimeZone)
+		if sendErr := b.sendMsgToEventGroup(eventInfo, notice); sendErr != nil {
+			log.Printf("sendMsgToEventGroup err %v\n", sendErr)
 		}
-	}()
-	// 读取活动基本信息
-	eventInfo, err := checkEventInformationFromId(db, eventID)
+	}
 	if err != nil {
-		log.Printf("checkCreateInformation ERROR %v\n", err)
 		return err
 	}
+	// 按时间或人数开奖的活动因人数达到而开奖时，不再需要开奖时间的定时任务
+	b.stopDrawTimer(eventID)
+	b.reportDrawExclusions(eventInfo, excluded)
 
-	if eventInfo.CancelStatus == true {
-		return fmt.Errorf("取消的活动ID: %v 取消开奖", eventInfo.ID)
+	luckyUsersList, err := b.store.ListWinners(eventID)
+	if err != nil {
+		log.Printf("ListWinners: %v", err)
+		return err
 	}
-	if eventInfo.OpenStatus == true {
-		return fmt.Errorf("已经开奖的活动ID %v，跳过", eventInfo.ID)
+	// 先私聊通知中奖者，群组中的开奖结果需要说明未能送达的中奖者
+	undelivered, err := b.sendPrizeToUser(eventID, luckyUsersList)
+	if err != nil {
+		log.Printf("sendPrizeToUser err %v\n", err)
 	}
-
-	// 读取活动参与者数组
-	partnerList, err := getParticipantsByEventID(db, eventID)
+	err = b.sendPrizeDrawMsgToGroup(eventInfo, luckyUsersList, undelivered)
 	if err != nil {
-		log.Println(err)
+		log.Printf("sendPrizeDrawMsgToGroup err %v\n", err)
 		return err
 	}
 
-	if len(partnerList) == 0 {
-		return fmt.Errorf("not found partner")
+	// 将活动公告替换为中奖名单
+	userNameStr, err := getAllLuckyUserName(b.store, eventID)
+	if err != nil {
+		log.Printf("getAllLuckyUserName error: %v", err)
+	} else {
+		b.finishAnnouncement(eventInfo, fmt.Sprintf("🎊 <b>已开奖，中奖者名单：</b>\n%s\n%s<b>开奖种子：</b> <code>%s</code>\n",
+			userNameStr, formatUnclaimedPrizes(eventInfo, len(luckyUsersList)), eventInfo.Seed))
 	}
-	// 确保奖品数量不超过参与者数量
-	if eventInfo.PrizeCount > len(partnerList) {
-		// 修改取消状态为True
-		eventInfo.CancelStatus = true
-		err = saveEventsInformation(db, eventInfo)
+	log.Printf("开奖完成，活动ID: %s", eventID)
+	return nil
+}
+
+// 抽取中奖者，任何一步失败都会回滚整个开奖，同一活动只会被成功开奖一次
+// missing 为开奖前检查出已退出必须加入的频道或群组的参与者及原因，确定开奖后与其他原因一起标记为失去资格
+// 返回开奖时因退出频道或群组、被禁止参与或中奖冷却规则失去抽奖资格的参与者及原因
+func (b *Bot) drawWinners(eventID string, vips map[int64]bool, missing map[int64]string) (eventInfo EventInformation, excluded map[int64]string, err error) {
+	b.drawMu.Lock()
+	defer b.drawMu.Unlock()
+
+	// 人数不足时取消或延长活动也需要提交事务，提交后再返回对应的错误
+	var outcome error
+	err = b.store.WithTx(func(tx Store) error {
+		// 读取活动基本信息
+		eventInfo, err = tx.GetEvent(eventID)
 		if err != nil {
-			return fmt.Errorf("save create information ERROR %v\n", err)
+			log.Printf("GetEvent ERROR %v\n", err)
+			return err
 		}
-		return fmt.Errorf("参与者数量不足，无法开奖,活动已取消")
-	}
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(len(eventID))))
+		if eventInfo.CancelStatus {
+			return fmt.Errorf("活动ID %v: %w", eventInfo.ID, errEventCanceled)
+		}
+		if eventInfo.OpenStatus {
+			return fmt.Errorf("活动ID %v: %w", eventInfo.ID, errEventAlreadyOpened)
+		}
 
-	// 随机打乱参与者列表
-	rng.Shuffle(len(partnerList), func(i, j int) {
-		partnerList[i], partnerList[j] = partnerList[j], partnerList[i]
-	})
+		// 读取活动参与者数组
+		partnerList, err := tx.ListParticipants(eventID)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
 
-	// 抽取中奖者并分配奖品
-	for i, winner := range partnerList[:eventInfo.PrizeCount] {
-		prize := eventInfo.ChoosePrizes[i]
+		// 排除已退出频道或群组、被禁止参与和中奖冷却期内的用户，确定开奖后才标记为失去资格，
+		// 延长开奖时间后用户可能已重新加入，禁止或冷却期也可能已经结束
+		reasons, err := cooldownExclusions(tx, eventInfo, time.Now())
+		if err != nil {
+			log.Printf("cooldownExclusions: %v", err)
+			return err
+		}
+		for userID, reason := range missing {
+			if _, ok := reasons[userID]; !ok {
+				reasons[userID] = reason
+			}
+		}
+		banned, err := tx.ListBannedUsers(eventID)
+		if err != nil {
+			log.Printf("ListBannedUsers: %v", err)
+			return err
+		}
+		for userID := range banned {
+			reasons[userID] = banIneligibleReason
+		}
+		partnerList, excluded = excludeParticipants(partnerList, reasons)
+
+		// 参与人数不足最少参与人数时，按活动设置取消、延长开奖时间或照常开奖
+		if len(partnerList) < minParticipants(eventInfo) {
+			action := minAction(eventInfo)
+			if action == minActionExtend && drawsAtTime(eventInfo) {
+				eventInfo.TimeOfWinners, err = extendOpenTime(eventInfo)
+				if err != nil {
+					return err
+				}
+				err = tx.SaveEvent(eventInfo)
+				if err != nil {
+					return fmt.Errorf("save create information ERROR %v\n", err)
+				}
+				outcome = errDrawExtended
+				return nil
+			}
+			if action != minActionDraw || len(partnerList) == 0 {
+				// 修改取消状态为True，提交事务后返回 errInsufficientParticipants
+				eventInfo.CancelStatus = true
+				err = tx.SaveEvent(eventInfo)
+				if err != nil {
+					return fmt.Errorf("save create information ERROR %v\n", err)
+				}
+				// 取消的活动不再发放奖品，预留的奖品退回库存
+				released, err := tx.ReleasePrizes(eventID)
+				if err != nil {
+					log.Printf("ReleasePrizes: %v", err)
+					return err
+				}
+				log.Printf("活动ID %s 参与人数不足已取消，%d 个预留的奖品已退回库存", eventID, released)
+				outcome = errInsufficientParticipants
+				return nil
+			}
+		}
+
+		for userID, reason := range excluded {
+			err = tx.MarkParticipantIneligible(eventID, userID, reason)
+			if err != nil {
+				log.Printf("MarkParticipantIneligible: %v", err)
+				return err
+			}
+		}
+		// 被邀请人在开奖时失去资格后不再计入邀请人数，重新读取参与者以更新邀请人数
+		if len(excluded) > 0 {
+			partnerList, err = tx.ListParticipants(eventID)
+			if err != nil {
+				return err
+			}
+		}
 
-		// 创建 LuckyUser 结构体
-		luckyUser := LuckyUser{
-			UserID:    winner.UserID,
-			UserName:  winner.UserName,
-			PrizeInfo: prize,
+		// 旧版本创建的活动没有预先承诺的种子，开奖时生成一个以便事后复算
+		if eventInfo.Seed == "" {
+			eventInfo.Seed, eventInfo.SeedCommitment, err = newSeed()
+			if err != nil {
+				return err
+			}
+			err = tx.SaveEvent(eventInfo)
+			if err != nil {
+				return fmt.Errorf("save create information ERROR %v\n", err)
+			}
 		}
 
-		// 将中奖者信息保存到数据库
-		err = saveLuckyUser(db, luckyUser, eventID)
+		// 计算并记录每位参与者的抽奖次数，复算时使用记录的抽奖次数
+		src, err := loadEntrySources(tx, eventInfo, vips)
 		if err != nil {
-			log.Printf("saveLuckyUser: %v", err)
 			return err
 		}
-	}
-	// 修改开奖状态为True
-	eventInfo.OpenStatus = true
-	err = saveEventsInformation(db, eventInfo)
-	if err != nil {
-		log.Printf("saveEventsInformation ERROR %v\n", err)
-		return err
-	}
-	luckyUsersList, err := getLuckyUsersListByEventID(db, eventID)
-	if err != nil {
-		log.Printf("getLuckyUsersListByEventID: %v", err)
-		return err
-	}
-	err = b.sendPrizeDrawMsgToGroup(eventInfo)
+		partnerList = applyEntries(eventInfo, partnerList, src)
+		err = tx.SaveEntries(eventID, partnerList)
+		if err != nil {
+			log.Printf("SaveEntries: %v", err)
+			return err
+		}
+
+		// 使用公开的种子对按参与时间排序的参与者洗牌（有参与者获得额外抽奖次数时按抽奖次数加权抽取），抽取中奖者，并按奖项顺序依次分配奖品
+		// 参与人数少于奖品数量时，只有前面奖项的奖品会被抽出
+		winners := pickWinners(eventInfo.Seed, partnerList, eventInfo.PrizeCount)
+		// 设置了领取期限的活动，中奖者须在期限内领取，逾期未领取时由候补依次递补
+		claimStatus, claimDeadline := "", ""
+		if eventInfo.ClaimHours > 0 {
+			claimStatus, claimDeadline = claimStatusPending, newClaimDeadline(eventInfo)
+		}
+		i := 0
+		for tierIndex, tier := range eventTiers(eventInfo) {
+			for _, prize := range tier.Prizes {
+				if i >= len(winners) {
+					break
+				}
+				winner := winners[i]
+				i++
+
+				// 创建 LuckyUser 结构体
+				luckyUser := LuckyUser{
+					UserID:        winner.UserID,
+					UserName:      winner.UserName,
+					PrizeInfo:     prize,
+					TierIndex:     tierIndex,
+					TierName:      tier.Name,
+					ClaimStatus:   claimStatus,
+					ClaimDeadline: claimDeadline,
+				}
+
+				// 将中奖者信息保存到数据库
+				_, err = tx.SaveWinner(eventID, luckyUser)
+				if err != nil {
+					log.Printf("SaveWinner: %v", err)
+					return err
+				}
+
+				// 将预留的奖品标记为已发放
+				err = tx.AwardPrize(eventID, prize)
+				if err != nil {
+					log.Printf("AwardPrize: %v", err)
+					return err
+				}
+			}
+		}
+
+		if eventInfo.ClaimHours > 0 && eventInfo.AlternateCount > 0 {
+			alternates := pickAlternates(eventInfo.Seed, partnerList, len(winners), eventInfo.AlternateCount)
+			err = tx.SaveAlternates(eventID, alternates)
+			if err != nil {
+				log.Printf("SaveAlternates: %v", err)
+				return err
+			}
+		}
+
+		// 参与人数少于奖品数量时，未抽出的奖品退回库存
+		if len(winners) < eventInfo.PrizeCount {
+			released, err := tx.ReleasePrizes(eventID)
+			if err != nil {
+				log.Printf("ReleasePrizes: %v", err)
+				return err
+			}
+			log.Printf("活动ID %s 有 %d 个奖品未抽出，已退回库存", eventID, released)
+		}
+
+		// 修改开奖状态为True，状态已被其他开奖修改时放弃本次开奖
+		opened, err := tx.MarkEventOpened(eventID)
+		if err != nil {
+			log.Printf("MarkEventOpened ERROR %v\n", err)
+			return err
+		}
+		if !opened {
+			return fmt.Errorf("活动ID %v: %w", eventID, errEventAlreadyOpened)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("sendPrizeDrawMsgToGroup err %v\n", err)
-		return err
+		return EventInformation{}, nil, err
 	}
-	err = b.sendPrizeToUser(eventID, luckyUsersList)
-	if err != nil {
-		log.Printf("sendPrizeToUser err %v\n", err)
-		return err
+	if outcome != nil {
+		return eventInfo, nil, outcome
 	}
-	log.Printf("开奖完成，活动ID: %s", eventID)
-	return nil
+	eventInfo.OpenStatus = true
+	return eventInfo, excluded, nil
 }
 
-// 根据时间开奖
+// 根据时间开奖：为未到开奖时间的活动设定定时任务，开奖时间已过（例如停机期间到期）的活动立即开奖；
+// 按人数开奖的活动参与人数已达到开奖人数（例如达到时开奖失败）时同样立即开奖
+// 同一活动由开奖事务保证只会被成功开奖一次，单个活动开奖失败不影响其他活动
 func (b *Bot) regularPrizeDraw() error {
-	// 初始化数据库
-	db, err := initDB()
+	// 加载未开奖和未取消的活动
+	eventInfo, err := b.store.ListOngoingEvents()
 	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
-		return err
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
-		}
-	}()
-	// 解析时区
-	timeLoc, err := time.LoadLocation(config.TimeZone)
-	if err != nil {
-		log.Printf("load timezone error: %v", err)
-		return err
-	}
-	// 加载所有活动
-	eventInfo, err := loadAllEvents(db)
-	if err != nil {
-		return fmt.Errorf("loadCreateInformation: %v", err)
+		return fmt.Errorf("ListOngoingEvents: %v", err)
 	}
 	if len(eventInfo) == 0 {
 		log.Printf("没有活动：%v", eventInfo)
 		return nil
 	}
+
+	var overdue []string
+	b.timersMu.Lock()
 	for _, value := range eventInfo {
-		if !value.OpenStatus && !value.CancelStatus {
-			if value.PrizeResultMethod == "1" {
-				openTime, err := time.ParseInLocation("20060102-15:04", value.TimeOfWinners, timeLoc)
-				if err != nil {
-					log.Printf("解析开奖时间失败: %v", err)
-					return err
-				}
+		if drawsAtCount(value) {
+			count, err := b.store.CountParticipants(value.ID)
+			if err != nil {
+				log.Printf("活动ID %s: %v", value.ID, err)
+			} else if count >= value.NumberOfWinners {
+				overdue = append(overdue, value.ID)
+				continue
+			}
+		}
+		if !drawsAtTime(value) {
+			continue
+		}
+		openTime, err := parseOpenTime(value)
+		if err != nil {
+			log.Printf("活动ID %s: %v", value.ID, err)
+			continue
+		}
 
-				b.timersMu.Lock()
-				// 检查是否已经存在定时任务
-				if _, exists := b.drawTimers[value.ID]; exists {
-					log.Printf("定时任务已存在，活动ID: %s", value.ID)
-					b.timersMu.Unlock()
-					continue
-				}
+		// 检查是否已经存在定时任务
+		if _, exists := b.drawTimers[value.ID]; exists {
+			log.Printf("定时任务已存在，活动ID: %s", value.ID)
+			continue
+		}
 
-				if time.Now().In(timeLoc).After(openTime) {
-					// 如果开奖时间小于当前时间，直接开奖
-					err = b.prizeDraw(value.ID)
-					if err != nil {
-						log.Printf("prizeDraw: %v", err)
-						b.timersMu.Unlock()
-						return err
-					}
-				} else if value.PrizeResultMethod != "2" {
-					// 否则设定定时任务
-					duration := time.Until(openTime)
-					timer := time.AfterFunc(duration, func() {
-						err := b.prizeDraw(value.ID)
-						if err != nil {
-							log.Printf("定时开奖失败: %v", err)
-						} else {
-							log.Printf("定时开奖成功，活动ID: %s", value.ID)
-						}
-
-						// 任务执行后删除记录
-						b.timersMu.Lock()
-						delete(b.drawTimers, value.ID)
-						b.timersMu.Unlock()
-					})
-					// 记录定时任务
-					b.drawTimers[value.ID] = timer
-					log.Printf("定时任务已设定，活动ID: %s，时间: %v", value.ID, openTime)
-				}
-				b.timersMu.Unlock()
-			}
+		if time.Now().After(openTime) {
+			// 如果开奖时间小于当前时间，释放锁后直接开奖
+			overdue = append(overdue, value.ID)
+			continue
 		}
+
+		// 否则设定定时任务
+		b.setDrawTimerLocked(value.ID, openTime)
+	}
+	b.timersMu.Unlock()
+
+	var drawErr error
+	for _, eventID := range overdue {
+		err = b.prizeDraw(eventID)
+		if err != nil {
+			log.Printf("活动ID %s 补开奖失败: %v", eventID, err)
+			drawErr = err
+			continue
+		}
+		log.Printf("活动ID %s 已达到开奖条件，已补开奖", eventID)
+	}
+	return drawErr
+}
+
+// 设定活动的开奖定时任务，调用方须持有 timersMu
+func (b *Bot) setDrawTimerLocked(eventID string, openTime time.Time) {
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(openTime), func() {
+		err := b.prizeDraw(eventID)
+		if errors.Is(err, errDrawExtended) {
+			log.Printf("活动ID %s 参与人数不足，已延长开奖时间", eventID)
+		} else if err != nil {
+			log.Printf("定时开奖失败: %v", err)
+		} else {
+			log.Printf("定时开奖成功，活动ID: %s", eventID)
+		}
+
+		// 任务执行后删除记录，开奖时间延长后记录已被新的定时任务替换
+		b.timersMu.Lock()
+		if b.drawTimers[eventID] == timer {
+			delete(b.drawTimers, eventID)
+		}
+		b.timersMu.Unlock()
+	})
+	// 记录定时任务
+	b.drawTimers[eventID] = timer
+	log.Printf("定时任务已设定，活动ID: %s，时间: %v", eventID, openTime)
+}
+
+// 停止活动的开奖定时任务
+func (b *Bot) stopDrawTimer(eventID string) {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+	if timer, exists := b.drawTimers[eventID]; exists {
+		timer.Stop()
+		delete(b.drawTimers, eventID)
+	}
+}
+
+// 开奖时间延长后，以新的开奖时间替换原有的定时任务
+func (b *Bot) rescheduleDraw(info EventInformation) {
+	openTime, err := parseOpenTime(info)
+	if err != nil {
+		log.Printf("活动ID %s: %v", info.ID, err)
+		return
+	}
+
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+	if timer, exists := b.drawTimers[info.ID]; exists {
+		timer.Stop()
+		delete(b.drawTimers, info.ID)
+	}
+	b.setDrawTimerLocked(info.ID, openTime)
+}
+
+// 停止所有开奖定时任务，已经开始执行的任务由 inflight 等待
+func (b *Bot) stopDrawTimers() {
+	b.timersMu.Lock()
+	defer b.timersMu.Unlock()
+	for eventID, timer := range b.drawTimers {
+		timer.Stop()
+		delete(b.drawTimers, eventID)
 	}
-	return nil
 }
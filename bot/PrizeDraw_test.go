@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// stubParticipant 模拟的参与记录
+type stubParticipant struct {
+	partner    Partner
+	referredBy int64
+	ineligible string // 失去抽奖资格的原因，为空表示具备资格
+}
+
+// stubDrawStore 只实现开奖用到的方法的内存 Store，调用其他方法会因内嵌的 Store 为 nil 而 panic
+type stubDrawStore struct {
+	Store
+	event        EventInformation
+	participants []*stubParticipant
+	banned       map[int64]bool
+	entries      map[int64]int
+	winners      []LuckyUser
+	awarded      []string
+	alternates   []Partner
+	released     int
+}
+
+func (s *stubDrawStore) WithTx(fn func(tx Store) error) error { return fn(s) }
+
+func (s *stubDrawStore) GetEvent(id string) (EventInformation, error) {
+	if id != s.event.ID {
+		return EventInformation{}, errors.New("event id does not exist")
+	}
+	return s.event, nil
+}
+
+func (s *stubDrawStore) SaveEvent(info EventInformation) error {
+	s.event = info
+	return nil
+}
+
+// 与 SQL 实现一致，只返回具备资格的参与者，邀请人数只统计具备资格的被邀请人
+func (s *stubDrawStore) ListParticipants(string) ([]Partner, error) {
+	var partners []Partner
+	for _, p := range s.participants {
+		if p.ineligible != "" {
+			continue
+		}
+		partner := p.partner
+		for _, r := range s.participants {
+			if r.referredBy == partner.UserID && r.ineligible == "" {
+				partner.Referrals++
+			}
+		}
+		partners = append(partners, partner)
+	}
+	return partners, nil
+}
+
+func (s *stubDrawStore) MarkParticipantIneligible(_ string, userID int64, reason string) error {
+	for _, p := range s.participants {
+		if p.partner.UserID == userID {
+			p.ineligible = reason
+		}
+	}
+	return nil
+}
+
+func (s *stubDrawStore) ListBannedUsers(string) (map[int64]bool, error) { return s.banned, nil }
+
+func (s *stubDrawStore) ListEntryWeights(string) (map[int64]int, error) { return nil, nil }
+
+func (s *stubDrawStore) ListMessageCounts(string) (map[int64]int, error) { return nil, nil }
+
+func (s *stubDrawStore) SaveEntries(_ string, partners []Partner) error {
+	s.entries = make(map[int64]int)
+	for _, partner := range partners {
+		s.entries[partner.UserID] = entryWeight(partner)
+	}
+	return nil
+}
+
+func (s *stubDrawStore) SaveWinner(_ string, luckyUser LuckyUser) (int64, error) {
+	s.winners = append(s.winners, luckyUser)
+	return int64(len(s.winners)), nil
+}
+
+func (s *stubDrawStore) AwardPrize(_ string, prize string) error {
+	s.awarded = append(s.awarded, prize)
+	return nil
+}
+
+func (s *stubDrawStore) SaveAlternates(_ string, partners []Partner) error {
+	s.alternates = partners
+	return nil
+}
+
+func (s *stubDrawStore) ReleasePrizes(string) (int, error) {
+	s.released = s.event.PrizeCount - len(s.awarded)
+	return s.released, nil
+}
+
+func (s *stubDrawStore) MarkEventOpened(string) (bool, error) {
+	if s.event.OpenStatus || s.event.CancelStatus {
+		return false, nil
+	}
+	s.event.OpenStatus = true
+	return true, nil
+}
+
+func newStubDrawStore(info EventInformation, participants ...*stubParticipant) *stubDrawStore {
+	return &stubDrawStore{event: info, participants: participants}
+}
+
+func stubJoin(userID int64, referredBy int64) *stubParticipant {
+	return &stubParticipant{partner: Partner{UserID: userID}, referredBy: referredBy}
+}
+
+func testDrawEvent() EventInformation {
+	return EventInformation{
+		ID:              "e1",
+		PrizeCount:      2,
+		NumberOfWinners: 2,
+		ChoosePrizes:    []string{"A", "B"},
+		Seed:            "seed-a",
+	}
+}
+
+func TestDrawWinners(t *testing.T) {
+	store := newStubDrawStore(testDrawEvent(), stubJoin(1, 0), stubJoin(2, 0), stubJoin(3, 0), stubJoin(4, 0), stubJoin(5, 0))
+	b := &Bot{store: store}
+
+	info, excluded, err := b.drawWinners("e1", nil, nil)
+	if err != nil {
+		t.Fatalf("drawWinners: %v", err)
+	}
+	if !info.OpenStatus || !store.event.OpenStatus {
+		t.Error("event was not marked opened")
+	}
+	if len(excluded) != 0 {
+		t.Errorf("excluded = %v, want none", excluded)
+	}
+
+	// 中奖者为固定种子下抽奖顺序的前两位，按顺序获得奖品
+	want := userIDs(drawOrder("seed-a", testPartners(1, 1, 1, 1, 1), 2))
+	var got []int64
+	for _, winner := range store.winners {
+		got = append(got, winner.UserID)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("winners = %v, want %v", got, want)
+	}
+	if !slices.Equal(store.awarded, []string{"A", "B"}) {
+		t.Errorf("awarded = %v, want [A B]", store.awarded)
+	}
+	if store.released != 0 {
+		t.Errorf("released = %d, want 0", store.released)
+	}
+	if len(store.entries) != 5 {
+		t.Errorf("entries saved for %d participants, want 5", len(store.entries))
+	}
+}
+
+func TestDrawWinnersExcludesBannedInvitees(t *testing.T) {
+	info := testDrawEvent()
+	info.ReferralCap = 3
+	// 用户 1 邀请了用户 2 和 3，用户 2 在开奖前被禁止参与
+	store := newStubDrawStore(info, stubJoin(1, 0), stubJoin(2, 1), stubJoin(3, 1), stubJoin(4, 0))
+	store.banned = map[int64]bool{2: true}
+	b := &Bot{store: store}
+
+	_, excluded, err := b.drawWinners("e1", nil, nil)
+	if err != nil {
+		t.Fatalf("drawWinners: %v", err)
+	}
+	if excluded[2] != banIneligibleReason || len(excluded) != 1 {
+		t.Errorf("excluded = %v, want only user 2", excluded)
+	}
+	if store.participants[1].ineligible != banIneligibleReason {
+		t.Error("banned participant was not marked ineligible")
+	}
+	if _, ok := store.entries[2]; ok {
+		t.Error("banned participant took part in the draw")
+	}
+	// 被禁止的被邀请人不再计入邀请人数
+	if store.entries[1] != 2 {
+		t.Errorf("entries of referrer = %d, want 2", store.entries[1])
+	}
+	for _, winner := range store.winners {
+		if winner.UserID == 2 {
+			t.Error("banned participant won a prize")
+		}
+	}
+}
+
+func TestDrawWinnersCancelsWithTooFewParticipants(t *testing.T) {
+	store := newStubDrawStore(testDrawEvent(), stubJoin(1, 0))
+	b := &Bot{store: store}
+
+	_, _, err := b.drawWinners("e1", nil, nil)
+	if !errors.Is(err, errInsufficientParticipants) {
+		t.Fatalf("err = %v, want errInsufficientParticipants", err)
+	}
+	if !store.event.CancelStatus || store.event.OpenStatus {
+		t.Errorf("event status open=%v cancel=%v, want canceled", store.event.OpenStatus, store.event.CancelStatus)
+	}
+	if store.released != 2 {
+		t.Errorf("released = %d, want 2", store.released)
+	}
+	if len(store.winners) != 0 {
+		t.Errorf("winners = %v, want none", store.winners)
+	}
+}
+
+func TestDrawWinnersSkipsOpenedEvent(t *testing.T) {
+	info := testDrawEvent()
+	info.OpenStatus = true
+	store := newStubDrawStore(info, stubJoin(1, 0), stubJoin(2, 0))
+	b := &Bot{store: store}
+
+	_, _, err := b.drawWinners("e1", nil, nil)
+	if !errors.Is(err, errEventAlreadyOpened) {
+		t.Fatalf("err = %v, want errEventAlreadyOpened", err)
+	}
+	if len(store.winners) != 0 {
+		t.Errorf("winners = %v, want none", store.winners)
+	}
+}
+
+// 已退出必须加入的频道或群组的参与者只在确定开奖后才被标记为失去资格
+func TestDrawWinnersMarksMissingMembersOnlyWhenDrawn(t *testing.T) {
+	missing := map[int64]string{2: "已退出 @channel"}
+
+	store := newStubDrawStore(testDrawEvent(), stubJoin(1, 0), stubJoin(2, 0))
+	b := &Bot{store: store}
+	_, _, err := b.drawWinners("e1", nil, missing)
+	if !errors.Is(err, errInsufficientParticipants) {
+		t.Fatalf("err = %v, want errInsufficientParticipants", err)
+	}
+	if store.participants[1].ineligible != "" {
+		t.Error("missing member was marked ineligible although the draw did not go ahead")
+	}
+
+	store = newStubDrawStore(testDrawEvent(), stubJoin(1, 0), stubJoin(2, 0), stubJoin(3, 0))
+	b = &Bot{store: store}
+	_, excluded, err := b.drawWinners("e1", nil, missing)
+	if err != nil {
+		t.Fatalf("drawWinners: %v", err)
+	}
+	if store.participants[1].ineligible != missing[2] || excluded[2] != missing[2] {
+		t.Errorf("missing member ineligible = %q, excluded = %v", store.participants[1].ineligible, excluded)
+	}
+	if _, ok := store.entries[2]; ok {
+		t.Error("missing member took part in the draw")
+	}
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+)
+
+// 管理员角色
+const (
+	roleOwner        = "owner"         // 所有者，拥有全部权限并可管理其他管理员
+	roleEventManager = "event_manager" // 活动管理员，可创建、开奖和关闭活动
+	rolePrizeManager = "prize_manager" // 奖品管理员，可添加和删除奖品
+	roleViewer       = "viewer"        // 只读管理员，只能查看奖品和活动
+)
+
+// 管理员权限
+type permission int
+
+const (
+	permView         permission = iota // 查看奖品和活动
+	permManageEvents                   // 创建、开奖和关闭活动
+	permManagePrizes                   // 添加和删除奖品
+	permManageAdmins                   // 管理其他管理员
+)
+
+// 各角色拥有的权限
+var rolePermissions = map[string][]permission{
+	roleOwner:        {permView, permManageEvents, permManagePrizes, permManageAdmins},
+	roleEventManager: {permView, permManageEvents},
+	rolePrizeManager: {permView, permManagePrizes},
+	roleViewer:       {permView},
+}
+
+// 角色的显示名称
+func roleDisplayName(role string) string {
+	switch role {
+	case roleOwner:
+		return "所有者"
+	case roleEventManager:
+		return "活动管理员"
+	case rolePrizeManager:
+		return "奖品管理员"
+	case roleViewer:
+		return "只读管理员"
+	}
+	return role
+}
+
+func roleHasPermission(role string, perm permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查用户是否拥有指定权限，chatID 为活动所属的抽奖群，为0时表示任意配置的抽奖群
+func (b *Bot) hasPermission(userID int64, perm permission, chatID int64) bool {
+	if b.hasGlobalPermission(userID, perm) {
+		return true
+	}
+
+	// 信任抽奖群的 Telegram 管理员时，群管理员拥有配置的角色
+	if config.TrustGroupAdmins && roleHasPermission(config.GroupAdminRole, perm) {
+		return b.isGroupAdmin(userID, chatID)
+	}
+	return false
+}
+
+// 检查用户是否拥有不限于某个抽奖群的权限，即配置文件中的管理员或添加的管理员，不包括信任的群管理员
+func (b *Bot) hasGlobalPermission(userID int64, perm permission) bool {
+	// 配置文件中的管理员始终是所有者
+	if userID == config.AdminUserID {
+		return true
+	}
+
+	role, ok, err := b.store.GetAdminRole(userID)
+	if err != nil {
+		log.Printf("GetAdminRole failed: %v", err)
+		return false
+	}
+	return ok && roleHasPermission(role, perm)
+}
+
+// 检查用户是否为抽奖群的 Telegram 管理员，chatID 为0时检查所有配置的抽奖群
+func (b *Bot) isGroupAdmin(userID int64, chatID int64) bool {
+	for _, group := range b.groups {
+		if chatID != 0 && group.ID != chatID {
+			continue
+		}
+		member, err := b.Bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: group.ID, UserID: userID},
+		})
+		if err != nil {
+			log.Printf("GetChatMember failed: %v", err)
+			continue
+		}
+		if member.IsCreator() || member.IsAdministrator() {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查发送消息的用户是否拥有指定权限，没有权限时回复提示
+func (b *Bot) checkPermission(msg *tgbotapi.Message, perm permission) bool {
+	if b.hasPermission(msg.From.ID, perm, 0) {
+		return true
+	}
+	if err := b.sendReply(msg, "你没有执行此指令的权限"); err != nil {
+		log.Printf("Error sending reply: %v", err)
+	}
+	return false
+}
+
+// 用户可以发布活动的抽奖群
+func (b *Bot) permittedGroups(userID int64) []lotteryGroup {
+	var groups []lotteryGroup
+	for _, group := range b.groups {
+		if b.hasPermission(userID, permManageEvents, group.ID) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 查询用户的管理员角色，不是管理员时 ok 为 false
+func (s *sqliteStore) GetAdminRole(userID int64) (role string, ok bool, err error) {
+	err = s.db.QueryRow("SELECT role FROM admins WHERE user_id = ?", userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("GetAdminRole ERROR: %v", err)
+	}
+	return role, true, nil
+}
+
+// 添加管理员，已是管理员时更新其角色
+func (s *sqliteStore) SaveAdmin(userID int64, role string, addedBy int64) error {
+	_, err := s.db.Exec(`
+	INSERT INTO admins (user_id, role, added_by) VALUES (?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET role=excluded.role, added_by=excluded.added_by
+	`, userID, role, addedBy)
+	if err != nil {
+		return fmt.Errorf("SaveAdmin ERROR: %v", err)
+	}
+	return nil
+}
+
+// 移除管理员，返回是否存在此管理员
+func (s *sqliteStore) DeleteAdmin(userID int64) (bool, error) {
+	result, err := s.db.Exec("DELETE FROM admins WHERE user_id = ?", userID)
+	if err != nil {
+		return false, fmt.Errorf("DeleteAdmin ERROR: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("DeleteAdmin ERROR: %v", err)
+	}
+	return affected > 0, nil
+}
+
+// 加载所有管理员，按添加时间排序
+func (s *sqliteStore) ListAdmins() ([]Admin, error) {
+	rows, err := s.db.Query("SELECT user_id, role, added_by, created_at FROM admins ORDER BY created_at, user_id")
+	if err != nil {
+		return nil, fmt.Errorf("ListAdmins ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close ERROR: %v", err)
+		}
+	}()
+
+	var admins []Admin
+	for rows.Next() {
+		var admin Admin
+		if err = rows.Scan(&admin.UserID, &admin.Role, &admin.AddedBy, &admin.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan admins ERROR: %v", err)
+		}
+		admins = append(admins, admin)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListAdmins ERROR: %v", err)
+	}
+	return admins, nil
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 保存活动的候补名单，候补顺序从1开始
+func (s *sqliteStore) SaveAlternates(eventID string, partners []Partner) error {
+	for i, partner := range partners {
+		_, err := s.db.Exec("INSERT INTO alternates (event_id, position, user_id, user_name) VALUES (?, ?, ?, ?)",
+			eventID, i+1, partner.UserID, partner.UserName)
+		if err != nil {
+			return fmt.Errorf("SaveAlternates ERROR: %v", err)
+		}
+	}
+	return nil
+}
+
+// 取出下一位尚未递补的候补并标记为已递补，没有候补时 ok 为 false
+func (s *sqliteStore) NextAlternate(eventID string) (alternate Alternate, ok bool, err error) {
+	err = s.withTx(func(tx *sqliteStore) error {
+		err := tx.db.QueryRow(`
+		SELECT event_id, position, user_id, user_name, promoted FROM alternates
+		WHERE event_id = ? AND promoted = 0
+		ORDER BY position LIMIT 1
+		`, eventID).Scan(&alternate.EventID, &alternate.Position, &alternate.UserID, &alternate.UserName, &alternate.Promoted)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("NextAlternate ERROR: %v", err)
+		}
+
+		_, err = tx.db.Exec("UPDATE alternates SET promoted = 1 WHERE event_id = ? AND position = ?", eventID, alternate.Position)
+		if err != nil {
+			return fmt.Errorf("NextAlternate ERROR: %v", err)
+		}
+		alternate.Promoted = true
+		ok = true
+		return nil
+	})
+	if err != nil {
+		return Alternate{}, false, err
+	}
+	return alternate, ok, nil
+}
+
+// 查询活动的候补名单，按候补顺序排列
+func (s *sqliteStore) ListAlternates(eventID string) ([]Alternate, error) {
+	rows, err := s.db.Query(`
+	SELECT event_id, position, user_id, user_name, promoted FROM alternates
+	WHERE event_id = ?
+	ORDER BY position
+	`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("ListAlternates ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close ERROR: %v", err)
+		}
+	}()
+
+	var alternates []Alternate
+	for rows.Next() {
+		var alternate Alternate
+		err = rows.Scan(&alternate.EventID, &alternate.Position, &alternate.UserID, &alternate.UserName, &alternate.Promoted)
+		if err != nil {
+			return nil, fmt.Errorf("scan alternates ERROR: %v", err)
+		}
+		alternates = append(alternates, alternate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListAlternates ERROR: %v", err)
+	}
+	return alternates, nil
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"time"
+)
+
+const (
+	announceUpdateInterval = time.Minute     // 刷新活动公告的间隔
+	announceEditGap        = 3 * time.Second // 两次编辑之间的最小间隔，避免触发 Telegram 的频率限制
+)
+
+// 生成活动公告的正文
+func (b *Bot) formatAnnouncement(eventInfo EventInformation) string {
+	sentGroupMsg := fmt.Sprintf(
+		"🎉 <b>新的抽奖活动发布啦</b> 🎁\n"+
+			"<b>抽奖群：</b> %s\n"+
+			"<b>奖品名称：</b> %s\n"+
+			"<b>奖品数量：</b> %d\n"+
+			"<b>开奖方式：</b> %s\n"+
+			"<b>参与方式：</b> %s\n",
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.GroupName),
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeName),
+		eventInfo.PrizeCount,
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeResult),
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.Participate),
+	)
+	sentGroupMsg += formatTiersHTML(eventInfo.Tiers)
+	sentGroupMsg += formatRequiredChatsHTML(eventInfo.RequiredChats)
+
+	if eventInfo.HowToParticipate == "1" {
+		sentGroupMsg += fmt.Sprintf("<b>关键词：</b> <code>%s</code>\n<b>参与抽奖指令：</b> <code>/join %v</code>，或点击下方按钮参与\n",
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.KeyWord),
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.KeyWord),
+		)
+	}
+
+	// 按时间或人数开奖的活动两者都显示，先到者开奖
+	if drawsAtTime(eventInfo) {
+		sentGroupMsg += fmt.Sprintf("<b>开奖时间：</b> <code>%s</code> %v\n",
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.TimeOfWinners),
+			config.TimeZone,
+		)
+	}
+	if drawsAtCount(eventInfo) {
+		sentGroupMsg += fmt.Sprintf("<b>开奖人数：</b> %d\n", eventInfo.NumberOfWinners)
+	}
+	sentGroupMsg += formatMinParticipantsHTML(eventInfo)
+	sentGroupMsg += formatClaimRuleHTML(eventInfo)
+	sentGroupMsg += formatEntryRulesHTML(eventInfo)
+	sentGroupMsg += formatCooldownRuleHTML(eventInfo)
+
+	if eventInfo.HowToParticipate == "2" {
+		sentGroupMsg += fmt.Sprintf("<b>参与抽奖：</b> 点击 <a href=\"%s\">此链接</a> 或下方按钮私聊机器人参与\n",
+			b.joinDeepLink(eventInfo.ID))
+	}
+
+	sentGroupMsg += fmt.Sprintf("<b>开奖种子承诺：</b> <code>%s</code>\n开奖时将公布种子，任何人都可以使用 <code>/verify %s</code> 复算中奖结果\n",
+		eventInfo.SeedCommitment, eventInfo.ID)
+	return sentGroupMsg
+}
+
+// 生成活动公告中的实时状态：参与人数，以及距离开奖的时间或剩余名额
+func formatAnnouncementStatus(eventInfo EventInformation, count int) string {
+	status := fmt.Sprintf("\n👥 <b>当前参与人数：</b> %d\n", count)
+	if drawsAtTime(eventInfo) {
+		openTime, err := parseOpenTime(eventInfo)
+		if err != nil {
+			log.Printf("活动ID %s: %v", eventInfo.ID, err)
+		} else {
+			status += fmt.Sprintf("⏳ <b>距离开奖：</b> %s\n", formatRemaining(time.Until(openTime)))
+		}
+	}
+	if drawsAtCount(eventInfo) {
+		remaining := eventInfo.NumberOfWinners - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		status += fmt.Sprintf("🎯 <b>还差 %d 人开奖</b>\n", remaining)
+	}
+	return status
+}
+
+// 将剩余时间格式化为 x天x小时x分钟，精确到分钟
+func formatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return "即将开奖"
+	}
+	minutes := int(d / time.Minute)
+	days, hours := minutes/(24*60), minutes/60%24
+	minutes %= 60
+	if days > 0 {
+		return fmt.Sprintf("%d天%d小时%d分钟", days, hours, minutes)
+	}
+	if hours > 0 {
+		return fmt.Sprintf("%d小时%d分钟", hours, minutes)
+	}
+	return fmt.Sprintf("%d分钟", minutes)
+}
+
+// 编辑活动公告，内容未变化时跳过，keyboard 为 nil 时移除按钮
+func (b *Bot) editAnnouncement(eventInfo EventInformation, text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	if eventInfo.AnnounceMessageID == 0 {
+		return
+	}
+
+	b.announceMu.Lock()
+	unchanged := b.announceTexts[eventInfo.ID] == text
+	b.announceMu.Unlock()
+	if unchanged {
+		return
+	}
+
+	editMsg := tgbotapi.NewEditMessageText(b.eventChatID(eventInfo), eventInfo.AnnounceMessageID, text)
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	if keyboard != nil {
+		editMsg.ReplyMarkup = keyboard
+	}
+	if _, err := b.Bot.Send(editMsg); err != nil {
+		log.Printf("edit announcement of event %s failed: %v", eventInfo.ID, err)
+		return
+	}
+
+	b.announceMu.Lock()
+	b.announceTexts[eventInfo.ID] = text
+	b.announceMu.Unlock()
+}
+
+// 刷新所有进行中活动的公告，停止时等待本次刷新结束后再关闭数据库，剩余的公告不再编辑
+func (b *Bot) refreshAnnouncements() {
+	if !b.beginWork() {
+		return
+	}
+	defer b.inflight.Done()
+
+	onEvents, err := b.store.ListOngoingEvents()
+	if err != nil {
+		log.Printf("ListOngoingEvents failed: %v", err)
+		return
+	}
+
+	for _, eventInfo := range onEvents {
+		if eventInfo.AnnounceMessageID == 0 {
+			continue
+		}
+		count, err := b.store.CountParticipants(eventInfo.ID)
+		if err != nil {
+			log.Printf("CountParticipants failed: %v", err)
+			continue
+		}
+
+		keyboard := b.announcementKeyboard(eventInfo, count)
+		text := b.formatAnnouncement(eventInfo) + formatAnnouncementStatus(eventInfo, count)
+
+		b.announceMu.Lock()
+		unchanged := b.announceTexts[eventInfo.ID] == text
+		b.announceMu.Unlock()
+		if unchanged {
+			continue
+		}
+		b.editAnnouncement(eventInfo, text, keyboard)
+		select {
+		case <-b.stopCh:
+			return
+		case <-time.After(announceEditGap):
+		}
+	}
+}
+
+// 定时刷新活动公告
+func (b *Bot) announcementLoop() {
+	ticker := time.NewTicker(announceUpdateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ticker.C:
+			b.refreshAnnouncements()
+		}
+	}
+}
+
+// 活动结束后将公告替换为最终结果并移除按钮
+func (b *Bot) finishAnnouncement(eventInfo EventInformation, result string) {
+	b.editAnnouncement(eventInfo, b.formatAnnouncement(eventInfo)+"\n"+result, nil)
+
+	b.announceMu.Lock()
+	delete(b.announceTexts, eventInfo.ID)
+	b.announceMu.Unlock()
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 被禁止参与的参与者开奖时失去抽奖资格的原因，管理员填写的原因只在 /banlist 中展示，不向用户展示
+const banIneligibleReason = "已被管理员禁止参与"
+
+// 解析禁止参与的时长，格式为 天数d 或 小时数h，例如 7d、12h
+func parseBanDuration(spec string) (time.Duration, error) {
+	if len(spec) < 2 {
+		return 0, fmt.Errorf("无效的时长: %s，格式为 7d 或 12h", spec)
+	}
+	n, err := strconv.Atoi(spec[:len(spec)-1])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("无效的时长: %s，格式为 7d 或 12h", spec)
+	}
+	switch spec[len(spec)-1] {
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, nil
+	case 'h':
+		return time.Duration(n) * time.Hour, nil
+	}
+	return 0, fmt.Errorf("无效的时长: %s，格式为 7d 或 12h", spec)
+}
+
+// 解析 /ban 的参数：用户ID [event=活动ID] [for=时长] [原因]，原因之后的内容都视为原因
+func parseBanArgs(args []string) (ban Ban, err error) {
+	if len(args) == 0 {
+		return Ban{}, fmt.Errorf("请指定用户ID")
+	}
+	ban.UserID, err = strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return Ban{}, fmt.Errorf("无效的用户ID: %s", args[0])
+	}
+
+	rest := args[1:]
+	for len(rest) > 0 {
+		key, value, found := strings.Cut(rest[0], "=")
+		if !found || (key != "event" && key != "for") {
+			break
+		}
+		if key == "event" {
+			ban.EventID = value
+		} else {
+			duration, err := parseBanDuration(value)
+			if err != nil {
+				return Ban{}, err
+			}
+			ban.ExpiresAt = time.Now().UTC().Add(duration).Format(dbTimeLayout)
+		}
+		rest = rest[1:]
+	}
+	ban.Reason = strings.Join(rest, " ")
+	return ban, nil
+}
+
+// 禁止参与的范围
+func formatBanScope(ban Ban) string {
+	if ban.EventID == "" {
+		return "所有活动"
+	}
+	return "活动 " + ban.EventID
+}
+
+// 禁止参与的到期时间
+func formatBanExpiry(ban Ban) string {
+	if ban.ExpiresAt == "" {
+		return "永久"
+	}
+	return formatDBTime(ban.ExpiresAt) + " " + config.TimeZone
+}
+
+// 被禁止参与的用户参与活动时的提示，与 banIneligibleReason 一样不包含管理员填写的原因
+func formatBanNotice(ban Ban) string {
+	notice := "你已被禁止参与" + formatBanScope(ban)
+	if ban.ExpiresAt != "" {
+		notice += "，到期时间：" + formatBanExpiry(ban)
+	}
+	return notice
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 禁止参与记录的查询列，顺序与 scanBan 的扫描顺序一致
+const banColumns = `user_id, event_id, reason, IFNULL(expires_at, ''), banned_by, IFNULL(created_at, '')`
+
+// 只返回仍在生效的记录
+const activeBanCondition = `(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+
+func scanBan(row rowScanner) (ban Ban, err error) {
+	err = row.Scan(&ban.UserID, &ban.EventID, &ban.Reason, &ban.ExpiresAt, &ban.BannedBy, &ban.CreatedAt)
+	return ban, err
+}
+
+// 禁止用户参与活动，已有同一范围的记录时替换其原因和到期时间
+func (s *sqliteStore) SaveBan(ban Ban) error {
+	_, err := s.db.Exec(`
+	INSERT INTO bans (user_id, event_id, reason, expires_at, banned_by) VALUES (?, ?, ?, NULLIF(?, ''), ?)
+	ON CONFLICT(user_id, event_id) DO UPDATE SET
+		reason=excluded.reason, expires_at=excluded.expires_at, banned_by=excluded.banned_by, created_at=CURRENT_TIMESTAMP
+	`, ban.UserID, ban.EventID, ban.Reason, ban.ExpiresAt, ban.BannedBy)
+	if err != nil {
+		return fmt.Errorf("SaveBan ERROR: %v", err)
+	}
+	return nil
+}
+
+// 解除禁止，返回是否存在仍在生效的记录
+func (s *sqliteStore) DeleteBan(userID int64, eventID string) (bool, error) {
+	var active bool
+	err := s.withTx(func(tx *sqliteStore) error {
+		err := tx.db.QueryRow("SELECT COUNT(*) > 0 FROM bans WHERE user_id = ? AND event_id = ? AND "+activeBanCondition,
+			userID, eventID).Scan(&active)
+		if err != nil {
+			return fmt.Errorf("DeleteBan ERROR: %v", err)
+		}
+		_, err = tx.db.Exec("DELETE FROM bans WHERE user_id = ? AND event_id = ?", userID, eventID)
+		if err != nil {
+			return fmt.Errorf("DeleteBan ERROR: %v", err)
+		}
+		return nil
+	})
+	return active, err
+}
+
+// 查询对指定活动生效的禁止记录，同时存在多条时返回到期时间最晚的一条
+func (s *sqliteStore) GetActiveBan(userID int64, eventID string) (ban Ban, ok bool, err error) {
+	ban, err = scanBan(s.db.QueryRow(`
+	SELECT `+banColumns+` FROM bans
+	WHERE user_id = ? AND (event_id = '' OR event_id = ?) AND `+activeBanCondition+`
+	ORDER BY expires_at IS NULL DESC, expires_at DESC
+	LIMIT 1
+	`, userID, eventID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Ban{}, false, nil
+		}
+		return Ban{}, false, fmt.Errorf("GetActiveBan ERROR: %v", err)
+	}
+	return ban, true, nil
+}
+
+// 加载所有仍在生效的禁止记录，最近添加的排在前面
+func (s *sqliteStore) ListActiveBans() ([]Ban, error) {
+	rows, err := s.db.Query("SELECT " + banColumns + " FROM bans WHERE " + activeBanCondition + " ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("ListActiveBans ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close ERROR: %v", err)
+		}
+	}()
+
+	var bans []Ban
+	for rows.Next() {
+		ban, err := scanBan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ListActiveBans ERROR: %v", err)
+		}
+		bans = append(bans, ban)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListActiveBans ERROR: %v", err)
+	}
+	return bans, nil
+}
+
+// 查询被禁止参与指定活动的用户
+func (s *sqliteStore) ListBannedUsers(eventID string) (map[int64]bool, error) {
+	counts, err := s.queryUserCounts("SELECT user_id, COUNT(*) FROM bans WHERE (event_id = '' OR event_id = ?) AND "+
+		activeBanCondition+" GROUP BY user_id", eventID)
+	if err != nil {
+		return nil, err
+	}
+	banned := make(map[int64]bool, len(counts))
+	for userID := range counts {
+		banned[userID] = true
+	}
+	return banned, nil
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 检查逾期未领取奖品的间隔
+const claimCheckInterval = time.Minute
+
+// 数据库中时间的格式，与 CURRENT_TIMESTAMP 一致，时区为 UTC
+const dbTimeLayout = "2006-01-02 15:04:05"
+
+// 从现在开始计算的领取期限
+func newClaimDeadline(info EventInformation) string {
+	return time.Now().UTC().Add(time.Duration(info.ClaimHours) * time.Hour).Format(dbTimeLayout)
+}
+
+// 生成领取规则的说明，无需领取的活动不显示
+func formatClaimRuleHTML(info EventInformation) string {
+	if info.ClaimHours <= 0 {
+		return ""
+	}
+	text := fmt.Sprintf("<b>领取期限：</b> 中奖后 %d 小时内私聊机器人点击领取", info.ClaimHours)
+	if info.AlternateCount > 0 {
+		text += fmt.Sprintf("，逾期由候补递补（候补 %d 人）", info.AlternateCount)
+	} else {
+		text += "，逾期奖品退回库存"
+	}
+	return text + "\n"
+}
+
+// 中奖通知上的领取按钮
+func claimKeyboard(winnerID int64) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("领取", "claim_"+strconv.FormatInt(winnerID, 10)),
+	))
+}
+
+// 生成中奖通知，待领取的奖品在领取后才显示
+func formatWinnerNotice(eventInfo EventInformation, user LuckyUser) string {
+	msgText := fmt.Sprintf(
+		"🎉 恭喜你中奖了！\n"+
+			"活动ID: %s\n"+
+			"群名称: %s\n"+
+			"活动名称: %s\n",
+		eventInfo.ID, eventInfo.GroupName, eventInfo.PrizeName,
+	)
+	if user.TierName != "" {
+		msgText += fmt.Sprintf("奖项: %s\n", user.TierName)
+	}
+	if user.ClaimStatus == claimStatusPending {
+		msgText += fmt.Sprintf("请在 %s %s 前点击下方按钮领取奖品，逾期未领取将由候补递补",
+			formatDBTime(user.ClaimDeadline), config.TimeZone)
+		return msgText
+	}
+	msgText += fmt.Sprintf("奖品: %v", user.PrizeInfo)
+	return msgText
+}
+
+// 私聊通知中奖者，待领取的通知附带领取按钮
+func (b *Bot) sendWinnerNotice(eventInfo EventInformation, user LuckyUser) error {
+	message := tgbotapi.NewMessage(user.UserID, formatWinnerNotice(eventInfo, user))
+	if user.ClaimStatus == claimStatusPending {
+		message.ReplyMarkup = claimKeyboard(user.ID)
+	}
+	_, err := b.Bot.Send(message)
+	return err
+}
+
+// 处理中奖通知上的领取按钮，结果以弹出提示的方式告知用户
+func (b *Bot) handleClaimCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	answer := func(text string) {
+		if _, err := b.Bot.Request(tgbotapi.NewCallback(callbackQuery.ID, text)); err != nil {
+			log.Printf("Error sending callback: %v", err)
+		}
+	}
+
+	winnerID, err := strconv.ParseInt(strings.TrimPrefix(callbackQuery.Data, "claim_"), 10, 64)
+	if err != nil {
+		log.Printf("Invalid claim data: %s", callbackQuery.Data)
+		answer("此按钮已失效")
+		return
+	}
+	winner, err := b.store.GetWinner(winnerID)
+	if err != nil {
+		log.Printf("GetWinner: %v", err)
+		answer("中奖记录不存在")
+		return
+	}
+	if winner.UserID != callbackQuery.From.ID {
+		answer("这不是你的奖品")
+		return
+	}
+
+	switch winner.ClaimStatus {
+	case claimStatusExpired:
+		answer("已超过领取期限，奖品已由候补递补")
+		return
+	case claimStatusPending:
+		claimed, err := b.store.ClaimPrize(winner.ID, winner.UserID)
+		if err != nil {
+			log.Printf("ClaimPrize: %v", err)
+			answer("领取失败，请稍后再试")
+			return
+		}
+		if !claimed {
+			answer("已超过领取期限，奖品将由候补递补")
+			return
+		}
+		winner.ClaimStatus = claimStatusClaimed
+		answer("🎉 领取成功！")
+	default:
+		answer("你已经领取过此奖品")
+	}
+
+	// 在中奖通知中显示奖品并移除领取按钮
+	eventInfo, err := b.store.GetEvent(winner.EventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return
+	}
+	editMsg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID,
+		formatWinnerNotice(eventInfo, winner))
+	if _, err := b.Bot.Send(editMsg); err != nil {
+		log.Printf("edit winner notice failed: %v", err)
+	}
+}
+
+// 定时检查逾期未领取的奖品
+func (b *Bot) claimLoop() {
+	ticker := time.NewTicker(claimCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stopCh:
+			return
+		case <-ticker.C:
+			b.expireClaims()
+		}
+	}
+}
+
+// 将逾期未领取的奖品递补给下一位候补
+func (b *Bot) expireClaims() {
+	if !b.beginWork() {
+		return
+	}
+	defer b.inflight.Done()
+
+	expired, err := b.store.ListExpiredClaims()
+	if err != nil {
+		log.Printf("ListExpiredClaims failed: %v", err)
+		return
+	}
+	for _, winner := range expired {
+		err = b.promoteAlternate(winner)
+		if err != nil {
+			log.Printf("活动ID %s 递补候补失败: %v", winner.EventID, err)
+		}
+	}
+}
+
+// 在同一事务中将逾期的中奖记录标记为过期并递补下一位候补，没有候补时奖品退回库存，之后通知新的中奖者和抽奖群
+func (b *Bot) promoteAlternate(expired LuckyUser) error {
+	var (
+		eventInfo    EventInformation
+		promoted     LuckyUser
+		handled      bool
+		hasAlternate bool
+	)
+	err := b.store.WithTx(func(tx Store) error {
+		// 记录已被领取或已被处理时跳过
+		ok, err := tx.ExpireClaim(expired.ID)
+		if err != nil || !ok {
+			return err
+		}
+		handled = true
+
+		eventInfo, err = tx.GetEvent(expired.EventID)
+		if err != nil {
+			return err
+		}
+		alternate, ok, err := tx.NextAlternate(expired.EventID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return tx.UnawardPrize(expired.EventID, expired.PrizeInfo)
+		}
+		hasAlternate = true
+
+		promoted = LuckyUser{
+			UserID:            alternate.UserID,
+			UserName:          alternate.UserName,
+			PrizeInfo:         expired.PrizeInfo,
+			EventID:           expired.EventID,
+			TierIndex:         expired.TierIndex,
+			TierName:          expired.TierName,
+			ClaimStatus:       claimStatusPending,
+			ClaimDeadline:     newClaimDeadline(eventInfo),
+			AlternatePosition: alternate.Position,
+		}
+		promoted.ID, err = tx.SaveWinner(expired.EventID, promoted)
+		return err
+	})
+	if err != nil || !handled {
+		return err
+	}
+
+	prize := "奖品"
+	if expired.TierName != "" {
+		prize = "「" + tgbotapi.EscapeText(tgbotapi.ModeHTML, expired.TierName) + "」的奖品"
+	}
+	notice := fmt.Sprintf("🔄 <b>%s 重新抽奖</b>\n@%s 未在期限内领取%s，",
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeName),
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, expired.UserName), prize)
+	if hasAlternate {
+		notice += fmt.Sprintf("由第 %d 位候补 @%s 递补，请在 %s %s 前私聊机器人领取",
+			promoted.AlternatePosition, tgbotapi.EscapeText(tgbotapi.ModeHTML, promoted.UserName),
+			formatDBTime(promoted.ClaimDeadline), config.TimeZone)
+		if err = b.deliverWinnerNotice(eventInfo, promoted); err != nil {
+			log.Printf("无法发送消息给用户 %d: %v", promoted.UserID, err)
+			notice += "\n" + b.formatUndeliveredHTML(eventInfo.ID, []LuckyUser{promoted})
+		}
+	} else {
+		notice += "没有更多候补，奖品已退回库存"
+	}
+	log.Printf("活动ID %s 的中奖者 %d 逾期未领取，已处理", expired.EventID, expired.UserID)
+	return b.sendMsgToEventGroup(eventInfo, notice)
+}
@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdAdd(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin.")
-		if err != nil {
-			return err
-		}
+	if !b.checkPermission(msg, permManagePrizes) {
 		return nil
 	}
 
@@ -20,9 +16,9 @@ func (b *Bot) cmdAdd(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	args := strings.TrimSpace(msg.CommandArguments())
+	pool, args := parsePoolPrefix(strings.TrimSpace(msg.CommandArguments()))
 	if args == "" {
-		err := b.sendReply(msg, "/add [需要添加的奖品，每个奖品用英文`分割]")
+		err := b.sendReply(msg, "/add [#奖池（可选）] [需要添加的奖品，每个奖品用英文`分割]")
 		if err != nil {
 			return err
 		}
@@ -50,10 +46,10 @@ func (b *Bot) cmdAdd(msg *tgbotapi.Message) error {
 		return nil
 	}
 
-	// 添加奖品到文件
-	err := addPrizesToPrizeTxtFile(validPrizes)
+	// 添加奖品到库存
+	err := b.store.AddPrizes(pool, validPrizes)
 	if err != nil {
-		log.Printf("addPrizesToPrizeTxtFile error: %v", err)
+		log.Printf("AddPrizes error: %v", err)
 		err = b.sendReply(msg, "添加奖品失败")
 		if err != nil {
 			return err
@@ -61,7 +57,8 @@ func (b *Bot) cmdAdd(msg *tgbotapi.Message) error {
 		return err
 	}
 
-	response := fmt.Sprintf("<b>添加奖品成功！共 %d 个</b>\n添加的奖品：\n", len(validPrizes))
+	response := fmt.Sprintf("<b>添加奖品成功！共 %d 个</b>\n<b>奖池：</b> %s\n添加的奖品：\n",
+		len(validPrizes), tgbotapi.EscapeText(tgbotapi.ModeHTML, poolDisplayName(pool)))
 	for _, prize := range validPrizes {
 		response += fmt.Sprintf("%s,", tgbotapi.EscapeText(tgbotapi.ModeHTML, prize))
 	}
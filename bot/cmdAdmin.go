@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+func (b *Bot) cmdAdmin(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permManageAdmins) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	usage := "*管理员管理：*\n" +
+		"`/admin add [用户ID] [角色]` 添加管理员或修改其角色\n" +
+		"`/admin remove [用户ID]` 移除管理员\n" +
+		"`/admin list` 查看所有管理员\n\n" +
+		"*角色：*\n" +
+		"`owner` 所有者，拥有全部权限并可管理其他管理员\n" +
+		"`event_manager` 活动管理员，可创建、开奖和关闭活动\n" +
+		"`prize_manager` 奖品管理员，可添加和删除奖品\n" +
+		"`viewer` 只读管理员，只能查看奖品和活动"
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		return b.sendReplyMarkDown(msg, usage)
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) != 3 {
+			return b.sendReplyMarkDown(msg, usage)
+		}
+		userID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return b.sendReply(msg, "无效的用户ID")
+		}
+		role := args[2]
+		if _, ok := rolePermissions[role]; !ok {
+			return b.sendReply(msg, "不支持的角色: "+role)
+		}
+		if userID == config.AdminUserID {
+			return b.sendReply(msg, "配置文件中的管理员始终是所有者，无需添加")
+		}
+		err = b.store.SaveAdmin(userID, role, msg.From.ID)
+		if err != nil {
+			return fmt.Errorf("SaveAdmin failed: %w", err)
+		}
+		return b.sendReply(msg, fmt.Sprintf("已将用户 %d 设置为%s", userID, roleDisplayName(role)))
+
+	case "remove":
+		if len(args) != 2 {
+			return b.sendReplyMarkDown(msg, usage)
+		}
+		userID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return b.sendReply(msg, "无效的用户ID")
+		}
+		if userID == config.AdminUserID {
+			return b.sendReply(msg, "无法移除配置文件中的管理员")
+		}
+		removed, err := b.store.DeleteAdmin(userID)
+		if err != nil {
+			return fmt.Errorf("DeleteAdmin failed: %w", err)
+		}
+		if !removed {
+			return b.sendReply(msg, fmt.Sprintf("用户 %d 不是管理员", userID))
+		}
+		return b.sendReply(msg, fmt.Sprintf("已移除管理员 %d", userID))
+
+	case "list":
+		admins, err := b.store.ListAdmins()
+		if err != nil {
+			return fmt.Errorf("ListAdmins failed: %w", err)
+		}
+		outputMsg := "<b>管理员列表：</b>\n"
+		outputMsg += fmt.Sprintf("<code>%d</code> | %s（配置文件）\n", config.AdminUserID, roleDisplayName(roleOwner))
+		for _, admin := range admins {
+			outputMsg += fmt.Sprintf("<code>%d</code> | %s | 添加者 <code>%d</code> | %s\n",
+				admin.UserID, roleDisplayName(admin.Role), admin.AddedBy, admin.CreatedAt)
+		}
+		if config.TrustGroupAdmins {
+			outputMsg += fmt.Sprintf("\n抽奖群的 Telegram 管理员拥有%s权限", roleDisplayName(config.GroupAdminRole))
+		}
+		return b.sendReplyHTML(msg, outputMsg)
+	}
+
+	return b.sendReplyMarkDown(msg, usage)
+}
@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// /banlist 每页显示的记录数量
+const banlistPageSize = 10
+
+const banUsage = "*禁止参与：*\n" +
+	"`/ban [用户ID] [event=活动ID] [for=时长] [原因]` 禁止用户参与所有活动或指定活动，时长格式为 7d 或 12h，不指定时永久禁止\n" +
+	"`/unban [用户ID] [event=活动ID]` 解除禁止\n" +
+	"`/banlist [页码]` 查看被禁止参与的用户\n\n" +
+	"已参与活动的用户被禁止后，开奖时失去抽奖资格"
+
+func (b *Bot) cmdBan(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permManageEvents) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		return b.sendReplyMarkDown(msg, banUsage)
+	}
+	ban, err := parseBanArgs(args)
+	if err != nil {
+		return b.sendReply(msg, err.Error())
+	}
+	if reply := b.checkBanScope(msg.From.ID, ban.EventID); reply != "" {
+		return b.sendReply(msg, reply)
+	}
+	ban.BannedBy = msg.From.ID
+
+	err = b.store.SaveBan(ban)
+	if err != nil {
+		log.Printf("SaveBan: %v", err)
+		return b.sendReply(msg, "保存失败，请稍后再试")
+	}
+	return b.sendReply(msg, fmt.Sprintf("已禁止用户 %d 参与%s，到期时间：%s", ban.UserID, formatBanScope(ban), formatBanExpiry(ban)))
+}
+
+func (b *Bot) cmdUnban(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permManageEvents) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		return b.sendReplyMarkDown(msg, banUsage)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return b.sendReply(msg, "无效的用户ID: "+args[0])
+	}
+	ban := Ban{UserID: userID}
+	if len(args) == 2 {
+		eventID, found := strings.CutPrefix(args[1], "event=")
+		if !found || eventID == "" {
+			return b.sendReplyMarkDown(msg, banUsage)
+		}
+		ban.EventID = eventID
+	}
+	if reply := b.checkBanScope(msg.From.ID, ban.EventID); reply != "" {
+		return b.sendReply(msg, reply)
+	}
+
+	removed, err := b.store.DeleteBan(ban.UserID, ban.EventID)
+	if err != nil {
+		log.Printf("DeleteBan: %v", err)
+		return b.sendReply(msg, "解除失败，请稍后再试")
+	}
+	if !removed {
+		return b.sendReply(msg, fmt.Sprintf("用户 %d 没有被禁止参与%s", ban.UserID, formatBanScope(ban)))
+	}
+	return b.sendReply(msg, fmt.Sprintf("已解除用户 %d 参与%s的禁止", ban.UserID, formatBanScope(ban)))
+}
+
+// 检查用户能否管理指定范围的禁止记录，不能时返回给用户的提示
+// 禁止参与所有活动会影响每个抽奖群，信任的群管理员只能管理本群活动的禁止记录
+func (b *Bot) checkBanScope(userID int64, eventID string) string {
+	if eventID == "" {
+		if !b.hasGlobalPermission(userID, permManageEvents) {
+			return "只有管理员可以禁止或解除禁止参与所有活动，群管理员请使用 event=活动ID 指定活动"
+		}
+		return ""
+	}
+	info, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return "活动不存在: " + eventID
+	}
+	if !b.hasPermission(userID, permManageEvents, b.eventChatID(info)) {
+		return "你没有管理此活动所属群组的权限"
+	}
+	return ""
+}
+
+func (b *Bot) cmdBanlist(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permView) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	// 默认页码为1
+	page := 1
+	if args := msg.CommandArguments(); args != "" {
+		parsedPage, err := strconv.Atoi(args)
+		if err != nil || parsedPage < 1 {
+			return b.sendReply(msg, "无效的页码，非正整数或超出范围")
+		}
+		page = parsedPage
+	}
+
+	// 发送指定页码的消息
+	b.sendPageCmdBanlist(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	return nil
+}
+
+func (b *Bot) sendPageCmdBanlist(chatID int64, messageID int, page int) {
+	bans, err := b.store.ListActiveBans()
+	if err != nil {
+		log.Printf("ListActiveBans failed: %v", err)
+		return
+	}
+	totalPages := (len(bans) + banlistPageSize - 1) / banlistPageSize
+
+	var outputMsg string
+	if totalPages == 0 {
+		outputMsg = "没有被禁止参与的用户"
+	} else {
+		// 解除禁止或到期后记录可能减少，页码超出范围时显示最后一页
+		page = min(max(page, 1), totalPages)
+		start := (page - 1) * banlistPageSize
+		end := min(start+banlistPageSize, len(bans))
+
+		outputMsg = fmt.Sprintf("<b>被禁止参与的用户</b>（共 %d 条）\n", len(bans))
+		for i, ban := range bans[start:end] {
+			outputMsg += fmt.Sprintf("\n<b>%d.</b> <code>%d</code>｜%s\n到期时间：%s｜操作人 <code>%d</code>\n",
+				start+i+1,
+				ban.UserID,
+				formatBanScope(ban),
+				formatBanExpiry(ban),
+				ban.BannedBy,
+			)
+			if ban.Reason != "" {
+				outputMsg += "原因：" + tgbotapi.EscapeText(tgbotapi.ModeHTML, ban.Reason) + "\n"
+			}
+		}
+		outputMsg += "\n使用 /unban 用户ID 解除禁止"
+	}
+
+	keyboard := b.generateCmdBanlistKeyboard(page, totalPages)
+
+	if messageID == 0 {
+		msg := tgbotapi.NewMessage(chatID, outputMsg)
+		msg.ParseMode = tgbotapi.ModeHTML
+		if len(keyboard.InlineKeyboard) > 0 {
+			msg.ReplyMarkup = keyboard
+		}
+		_, err := b.Bot.Send(msg)
+		if err != nil {
+			log.Printf("sendMessage failed: %v", err)
+		}
+	} else {
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, outputMsg)
+		editMsg.ParseMode = tgbotapi.ModeHTML
+		editMsg.ReplyMarkup = &keyboard
+		_, err := b.Bot.Send(editMsg)
+		if err != nil {
+			log.Printf("sendMessage failed: %v", err)
+		}
+	}
+}
+
+func (b *Bot) generateCmdBanlistKeyboard(currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+
+	// 只有一页时不显示翻页按钮
+	if totalPages > 1 {
+		var pageRow []tgbotapi.InlineKeyboardButton
+		if currentPage > 1 {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdBanlistPage"+strconv.Itoa(currentPage-1)))
+		}
+		pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"))
+		if currentPage < totalPages {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdBanlistPage"+strconv.Itoa(currentPage+1)))
+		}
+		rows = append(rows, pageRow)
+	}
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdCancel(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin")
-		if err != nil {
-			return fmt.Errorf("sendReply failed: %w", err)
-		}
+	if !b.checkPermission(msg, permView) {
 		return nil
 	}
 
@@ -20,24 +16,13 @@ func (b *Bot) cmdCancel(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		return fmt.Errorf("initDB failed: %w", err)
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
-
 	//加载取消的活动
-	b.cancelEvents, err = loadCancelEvents(db)
+	cancelEvents, err := b.store.ListCanceledEvents()
 	if err != nil {
-		return fmt.Errorf("loadCancelEvents failed: %w", err)
+		return fmt.Errorf("ListCanceledEvents failed: %w", err)
 	}
 
-	if len(b.cancelEvents) == 0 {
+	if len(cancelEvents) == 0 {
 		err = b.sendReply(msg, "没有取消的活动")
 		if err != nil {
 			return fmt.Errorf("sendReply failed: %w", err)
@@ -51,7 +36,7 @@ func (b *Bot) cmdCancel(msg *tgbotapi.Message) error {
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.cancelEvents) {
+		if err == nil && parsedPage > 0 && parsedPage <= len(cancelEvents) {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -63,12 +48,12 @@ func (b *Bot) cmdCancel(msg *tgbotapi.Message) error {
 		}
 	}
 	// 发送指定页码的消息
-	b.sendPageCmdCancel(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdCancel(msg.Chat.ID, 0, cancelEvents, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdCancel(chatID int64, messageID int, page int) {
-	totalPages := len(b.cancelEvents)
+func (b *Bot) sendPageCmdCancel(chatID int64, messageID int, cancelEvents []EventInformation, page int) {
+	totalPages := len(cancelEvents)
 
 	// 检查切片是否为空或页码是否超出范围
 	if totalPages == 0 {
@@ -89,9 +74,9 @@ func (b *Bot) sendPageCmdCancel(chatID int64, messageID int, page int) {
 		return
 	}
 
-	info := b.cancelEvents[page-1]
+	info := cancelEvents[page-1]
 
-	outputMsg, err := createAllEventInfoMsg(info)
+	outputMsg, err := b.createAllEventInfoMsg(info)
 	if err != nil {
 		log.Printf("createAllEventInfoMsg failed: %v", err)
 		return
@@ -7,11 +7,7 @@ import (
 )
 
 func (b *Bot) cmdClose(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin")
-		if err != nil {
-			return err
-		}
+	if !b.checkPermission(msg, permManageEvents) {
 		return nil
 	}
 
@@ -19,23 +15,9 @@ func (b *Bot) cmdClose(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "无法连接到数据库")
-		_, err := b.Bot.Send(reply)
-		return err
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
-		}
-	}()
-
 	args := strings.Split(msg.CommandArguments(), " ")
 	if len(args) == 0 || args[0] == "" {
-		err = b.sendReply(msg, "/close [活动ID]")
+		err := b.sendReply(msg, "/close [活动ID]")
 		if err != nil {
 			log.Printf("sendReply: %v", err)
 			return err
@@ -44,12 +26,17 @@ func (b *Bot) cmdClose(msg *tgbotapi.Message) error {
 	}
 
 	inputID := args[0]
-	info, err := checkEventInformationFromId(db, inputID)
+	info, err := b.store.GetEvent(inputID)
 	if err != nil {
-		log.Printf("checkEventInformationFromId: %v", err)
+		log.Printf("GetEvent: %v", err)
 		return err
 	}
 
+	// 只能管理自己有权限的抽奖群中的活动
+	if !b.hasPermission(msg.From.ID, permManageEvents, b.eventChatID(info)) {
+		return b.sendReply(msg, "你没有管理此活动所属群组的权限")
+	}
+
 	if info.CancelStatus {
 		err = b.sendReply(msg, "此活动已取消，请勿重复取消")
 		if err != nil {
@@ -68,13 +55,21 @@ func (b *Bot) cmdClose(msg *tgbotapi.Message) error {
 		return nil
 	}
 
-	info.CancelStatus = true
-	err = saveEventsInformation(db, info)
+	canceled, err := b.cancelEvent(info.ID)
 	if err != nil {
-		log.Printf("saveEventsInformation: %v", err)
+		log.Printf("cancelEvent: %v", err)
+		return b.sendReply(msg, "取消失败，请稍后再试")
+	}
+	if !canceled {
+		// 读取活动后活动已被开奖或取消
+		return b.sendReply(msg, "此活动已经开奖或已取消，无法取消")
 	}
+	// 已取消的活动不再需要开奖时间的定时任务
+	b.stopDrawTimer(info.ID)
+	info.CancelStatus = true
+	b.finishAnnouncement(info, "❌ <b>活动已被管理员取消</b>")
 
-	outputMsg, err := createAllEventInfoMsg(info)
+	outputMsg, err := b.createAllEventInfoMsg(info)
 	if err != nil {
 		log.Printf("createAllEventInfoMsg: %v", err)
 	}
@@ -86,3 +81,26 @@ func (b *Bot) cmdClose(msg *tgbotapi.Message) error {
 	}
 	return nil
 }
+
+// 取消未开奖的活动并将预留的奖品退回库存，与开奖互斥，活动已开奖或已取消时返回 false
+func (b *Bot) cancelEvent(eventID string) (canceled bool, err error) {
+	b.drawMu.Lock()
+	defer b.drawMu.Unlock()
+
+	err = b.store.WithTx(func(tx Store) error {
+		canceled, err = tx.MarkEventCanceled(eventID)
+		if err != nil || !canceled {
+			return err
+		}
+		released, err := tx.ReleasePrizes(eventID)
+		if err != nil {
+			return err
+		}
+		log.Printf("活动ID %s 已取消，%d 个预留的奖品已退回库存", eventID, released)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return canceled, nil
+}
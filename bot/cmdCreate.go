@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
@@ -10,13 +11,7 @@ import (
 )
 
 func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
-	var eventInfo EventInformation
-
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "you are not an admin")
-		if err != nil {
-			log.Printf("Error sending reply: %v", err)
-		}
+	if !b.checkPermission(msg, permManageEvents) {
 		return nil
 	}
 
@@ -24,7 +19,12 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	eventInfo.AllPrizes, err = loadPrizes()
+	// 不带参数时进入分步创建向导
+	if strings.TrimSpace(msg.CommandArguments()) == "" {
+		return b.startCreateWizard(msg)
+	}
+
+	prizes, err := b.store.ListAvailablePrizes()
 	if err != nil {
 		err = b.sendReply(msg, "Error loading prizes")
 		if err != nil {
@@ -35,33 +35,46 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 
 	args := strings.Split(msg.CommandArguments(), " ")
 	if len(args) < 6 {
-		err = b.sendReplyMarkDown(msg, "*开奖方法：*\n1.按时间开奖\n2.按人数开奖\n\n"+
+		err = b.sendReplyMarkDown(msg, "直接发送 /create 可使用分步创建向导\n\n"+
+			"*开奖方法：*\n1.按时间开奖\n2.按人数开奖\n3.按时间或人数开奖，先到者开奖\n\n"+
 			"*参与方法：*\n1.群组内发送关键词\n2.私聊机器人参与\n\n"+
 			"*传递说明：*\n"+
-			"`/create [活动名称] [奖品数量] [开奖方法1/2] [选1填时间，选2填人数] [参与方法1/2] [选1填关键词，选2填 私聊机器人参与]`\n\n"+
+			"`/create [活动名称] [奖品数量] [开奖方法1/2/3] [选1填时间，选2填人数，选3填 时间,人数] [参与方法1/2] [选1填关键词，选2填 私聊机器人参与]`\n\n"+
+			"*可选参数：*\n"+
+			"`tiers=名称:数量[:奖池],...` 设置多个奖项，按顺序开奖，数量之和须等于奖品数量\n"+
+			"`group=群组用户名或会话ID` 指定发布活动的抽奖群，默认为第一个配置的群组\n"+
+			"`require=频道或群组,...` 参与者必须加入的频道或群组，开奖前会再次检查\n"+
+			"`min=人数` 开奖所需的最少参与人数，默认为奖品数量\n"+
+			"`min_action=cancel|extend[:小时]|draw` 人数不足时取消活动（默认）、延长开奖时间（默认24小时）或照常开奖，"+
+			"照常开奖时奖品多于参与人数则全员中奖，剩余奖品退回库存\n"+
+			"`claim=小时` 中奖者须在开奖后指定小时内私聊机器人点击领取，逾期由候补递补\n"+
+			"`alternates=人数` 候补人数，默认与奖品数量相同，需要同时设置 claim\n"+
+			"`referral=次数` 每邀请一位好友参与增加一次抽奖机会，最多增加的次数\n"+
+			"`msg_entries=消息数[:次数]` 活动期间在抽奖群中每发送指定数量的消息增加一次抽奖机会，可设置最多增加的次数\n"+
+			"`vip=倍数` 抽奖群管理员和 VIP 名单中的用户的抽奖次数乘以此倍数\n"+
+			"`cooldown=天数` 开奖时排除指定天数内中过奖的用户，0 表示不启用，默认使用配置文件中的设置\n"+
+			"`cooldown_events=场数` 开奖时排除在最近指定场数的活动中中过奖的用户\n"+
+			"`monthly_cap=次数` 本月中奖次数达到此数的用户开奖时不参与抽奖\n\n"+
 			"*示例：*\n"+
 			"`/create 我要抽奖 10 1 20240823-23:07 1 抽奖`\n"+
 			"`/create 我要抽奖 10 1 20240823-23:07 2 私聊机器人参与`\n"+
 			"`/create 我要抽奖 10 2 30 1 抽奖`\n"+
-			"`/create 我要抽奖 10 2 30 2 私聊机器人参与`")
+			"`/create 我要抽奖 10 2 30 2 私聊机器人参与`\n"+
+			"`/create 我要抽奖 14 1 20240823-23:07 1 抽奖 tiers=一等奖:1:大奖,二等奖:3,参与奖:10`\n"+
+			"`/create 我要抽奖 10 2 30 1 抽奖 group=@example`\n"+
+			"`/create 我要抽奖 10 2 30 1 抽奖 require=@channel`\n"+
+			"`/create 我要抽奖 10 3 20240823-23:07,30 1 抽奖 min=5 min_action=extend:12`")
 		if err != nil {
 			return fmt.Errorf("error sending reply MarkDown: %v", err)
 		}
 		return nil
 	}
 
-	timeZone, err := time.LoadLocation(config.TimeZone)
-	if err != nil {
-		return fmt.Errorf("error loading timezone: %v", err)
-	}
-
-	eventInfo.ID = time.Now().In(timeZone).Format("20060102150405")
-
-	groupInfo, err := b.getGroupInfo()
+	eventInfo, err := b.newEventDraft()
 	if err != nil {
-		return fmt.Errorf("error getting group info: %v", err)
+		return err
 	}
-	eventInfo.GroupName = groupInfo.Title
+	eventInfo.AllPrizes = prizeTexts(prizes)
 
 	eventInfo.PrizeName = args[0]
 
@@ -74,6 +87,11 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		return nil
 	}
 
+	// 所有开奖方式都要求至少一个奖品，数量为0或负数的活动开奖时无法抽取
+	if eventInfo.PrizeCount < 1 {
+		return b.sendReply(msg, "奖品数量必须大于0")
+	}
+
 	if eventInfo.PrizeCount > len(eventInfo.AllPrizes) {
 		err = b.sendReply(msg, "奖品数量超出了总奖品数量")
 		if err != nil {
@@ -82,31 +100,87 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		return nil
 	}
 
-	eventInfo.ChoosePrizes = eventInfo.AllPrizes[:eventInfo.PrizeCount]
+	options, err := parseCreateOptions(args[6:])
+	if err != nil {
+		return b.sendReply(msg, err.Error())
+	}
+
+	// 未设置奖项时，全部奖品作为一个奖项从默认奖池中选取
+	tiers := []PrizeTier{{Count: eventInfo.PrizeCount}}
+	if spec, ok := options["tiers"]; ok {
+		tiers, err = parseTiers(spec)
+		if err != nil {
+			return b.sendReply(msg, err.Error())
+		}
+		if tiersPrizeCount(tiers) != eventInfo.PrizeCount {
+			return b.sendReply(msg, "各奖项的数量之和必须等于奖品数量")
+		}
+	}
+	err = choosePrizesForTiers(prizes, tiers)
+	if err != nil {
+		return b.sendReply(msg, err.Error())
+	}
+	eventInfo.Tiers = tiers
+	eventInfo.ChoosePrizes = tiersPrizes(tiers)
+
+	// 未指定群组时发布到默认群组
+	group := b.groups[0]
+	if ref, ok := options["group"]; ok {
+		group, ok = b.findGroup(ref)
+		if !ok {
+			return b.sendReply(msg, "未配置的群组: "+ref)
+		}
+	}
+	if !b.hasPermission(msg.From.ID, permManageEvents, group.ID) {
+		return b.sendReply(msg, "你没有在此群组发布活动的权限: "+group.Title)
+	}
+	setEventGroup(&eventInfo, group)
+
+	if spec, ok := options["require"]; ok {
+		eventInfo.RequiredChats, err = b.parseRequiredChats(spec)
+		if err != nil {
+			return b.sendReply(msg, err.Error())
+		}
+	}
 
 	eventInfo.PrizeResultMethod = args[2]
-	if eventInfo.PrizeResultMethod == "1" {
-		eventInfo.PrizeResult = "按时间开奖"
-		inputTime := args[3]
-		err = CheckTime(inputTime)
+	inputTime := args[3]
+	switch eventInfo.PrizeResultMethod {
+	case "2":
+		eventInfo.NumberOfWinners, err = strconv.Atoi(args[3])
 		if err != nil {
-			err = b.sendReply(msg, err.Error())
+			err = b.sendReply(msg, "请传递一个整数--开奖人数")
 			if err != nil {
 				log.Printf("Error sending reply: %v", err)
 			}
 			return nil
 		}
-		eventInfo.TimeOfWinners = inputTime
-	} else if eventInfo.PrizeResultMethod == "2" {
-		eventInfo.PrizeResult = "按人数开奖"
-		eventInfo.NumberOfWinners, err = strconv.Atoi(args[3])
+	case "3":
+		inputTime, eventInfo.NumberOfWinners, err = parseHybridTrigger(args[3])
 		if err != nil {
-			err = b.sendReply(msg, "请传递一个整数--开奖人数")
+			return b.sendReply(msg, err.Error())
+		}
+	}
+	eventInfo.PrizeResult = drawMethodNames[eventInfo.PrizeResultMethod]
+	if eventInfo.PrizeResult == "" {
+		err = b.sendReply(msg, "传递了不受支持的参数--[开奖方法1/2/3]")
+		if err != nil {
+			log.Printf("Error sending reply: %v", err)
+		}
+		return nil
+	}
+	if drawsAtTime(eventInfo) {
+		err = CheckTime(inputTime)
+		if err != nil {
+			err = b.sendReply(msg, err.Error())
 			if err != nil {
 				log.Printf("Error sending reply: %v", err)
 			}
 			return nil
 		}
+		eventInfo.TimeOfWinners = inputTime
+	}
+	if drawsAtCount(eventInfo) {
 		if eventInfo.PrizeCount < 1 || eventInfo.PrizeCount > len(eventInfo.AllPrizes) || eventInfo.PrizeCount > eventInfo.NumberOfWinners {
 			err = b.sendReply(msg, "无效的[奖品数量]，必须大于0,小于或等于开奖人数")
 			if err != nil {
@@ -114,12 +188,77 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 			}
 			return nil
 		}
-	} else {
-		err = b.sendReply(msg, "传递了不受支持的参数--[开奖方法1/2]")
+	}
+
+	if spec, ok := options["min"]; ok {
+		eventInfo.MinParticipants, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.MinParticipants < 1 {
+			return b.sendReply(msg, "最少参与人数必须是正整数: "+spec)
+		}
+	}
+	if spec, ok := options["min_action"]; ok {
+		eventInfo.MinAction, eventInfo.ExtendHours, err = parseMinAction(spec)
 		if err != nil {
-			log.Printf("Error sending reply: %v", err)
+			return b.sendReply(msg, err.Error())
+		}
+	}
+	err = checkMinParticipantsRule(eventInfo)
+	if err != nil {
+		return b.sendReply(msg, err.Error())
+	}
+
+	if spec, ok := options["claim"]; ok {
+		eventInfo.ClaimHours, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.ClaimHours < 1 {
+			return b.sendReply(msg, "领取期限必须是正整数（小时）: "+spec)
+		}
+		// 默认每个奖品有一位候补
+		eventInfo.AlternateCount = eventInfo.PrizeCount
+	}
+	if spec, ok := options["alternates"]; ok {
+		if eventInfo.ClaimHours == 0 {
+			return b.sendReply(msg, "设置候补人数时需要同时设置领取期限 claim=小时")
+		}
+		eventInfo.AlternateCount, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.AlternateCount < 0 {
+			return b.sendReply(msg, "候补人数必须是非负整数: "+spec)
+		}
+	}
+	if spec, ok := options["referral"]; ok {
+		eventInfo.ReferralCap, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.ReferralCap < 1 {
+			return b.sendReply(msg, "邀请奖励的次数上限必须是正整数: "+spec)
+		}
+	}
+	if spec, ok := options["msg_entries"]; ok {
+		eventInfo.MessagesPerEntry, eventInfo.MessageEntriesCap, err = parseMessageEntries(spec)
+		if err != nil {
+			return b.sendReply(msg, err.Error())
+		}
+	}
+	if spec, ok := options["vip"]; ok {
+		eventInfo.VIPMultiplier, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.VIPMultiplier < 2 {
+			return b.sendReply(msg, "VIP 倍数必须是大于 1 的整数: "+spec)
+		}
+	}
+	if spec, ok := options["cooldown"]; ok {
+		eventInfo.CooldownDays, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.CooldownDays < 0 {
+			return b.sendReply(msg, "中奖冷却天数必须是非负整数: "+spec)
+		}
+	}
+	if spec, ok := options["cooldown_events"]; ok {
+		eventInfo.CooldownEvents, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.CooldownEvents < 0 {
+			return b.sendReply(msg, "中奖冷却场数必须是非负整数: "+spec)
+		}
+	}
+	if spec, ok := options["monthly_cap"]; ok {
+		eventInfo.MonthlyWinCap, err = strconv.Atoi(spec)
+		if err != nil || eventInfo.MonthlyWinCap < 0 {
+			return b.sendReply(msg, "每月中奖次数上限必须是非负整数: "+spec)
 		}
-		return nil
 	}
 
 	eventInfo.HowToParticipate = args[4]
@@ -143,8 +282,47 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		return nil
 	}
 
-	eventInfo.PrizesList = fmt.Sprintf("%v", strings.Join(eventInfo.ChoosePrizes, "\n"))
+	eventInfo.PrizesList = formatTierPrizesList(eventInfo.Tiers)
+
+	// 保存待确认的活动，机器人重启后仍可继续确认
+	err = b.setWizardState(msg.From.ID, wizardStateConfirm, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+
+	return b.sendCreateConfirmation(msg.Chat.ID, eventInfo)
+}
+
+// 同一秒内发布的活动最多尝试的活动ID数量
+const maxEventIDAttempts = 10
+
+// 以当前时间生成活动ID
+func newEventID() (string, error) {
+	timeZone, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return "", fmt.Errorf("error loading timezone: %v", err)
+	}
+	return time.Now().In(timeZone).Format("20060102150405"), nil
+}
+
+// 生成新活动的ID和开奖种子，确认发布时会重新生成活动ID
+func (b *Bot) newEventDraft() (eventInfo EventInformation, err error) {
+	eventInfo.ID, err = newEventID()
+	if err != nil {
+		return EventInformation{}, err
+	}
+
+	// 生成开奖种子，发布活动时只公布种子的承诺，开奖时再公布种子
+	eventInfo.Seed, eventInfo.SeedCommitment, err = newSeed()
+	if err != nil {
+		return EventInformation{}, fmt.Errorf("error generating seed: %v", err)
+	}
+	applyDefaultCooldown(&eventInfo)
+	return eventInfo, nil
+}
 
+// 发送待确认的活动信息，附带确认发布和取消按钮
+func (b *Bot) sendCreateConfirmation(chatID int64, eventInfo EventInformation) error {
 	confirmation := fmt.Sprintf(
 		"<b>抽奖群：</b> %s\n<b>奖品名称：</b> %s\n<b>奖品数量：</b> %d\n<b>开奖方式：</b> %s\n<b>参与方式：</b> %s\n<b>奖品列表：</b><pre>%v</pre>\n",
 		eventInfo.GroupName,
@@ -154,6 +332,8 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		eventInfo.Participate,
 		eventInfo.PrizesList,
 	)
+	confirmation += formatTiersHTML(eventInfo.Tiers)
+	confirmation += formatRequiredChatsHTML(eventInfo.RequiredChats)
 
 	if eventInfo.HowToParticipate == "1" {
 		confirmation += fmt.Sprintf("<b>关键词：</b> <code>%s</code>\n<b>参与指令：</b> <code>/join %v</code>\n", eventInfo.KeyWord, eventInfo.KeyWord)
@@ -161,14 +341,16 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 		confirmation += "<b>参与指令：</b> <code>/join</code>\n"
 	}
 
-	if eventInfo.PrizeResultMethod == "1" {
-		confirmation += fmt.Sprintf("<b>开奖时间：</b> <code>%s</code> %v\n", eventInfo.TimeOfWinners, timeZone)
-	} else if eventInfo.PrizeResultMethod == "2" {
+	if drawsAtTime(eventInfo) {
+		confirmation += fmt.Sprintf("<b>开奖时间：</b> <code>%s</code> %v\n", eventInfo.TimeOfWinners, config.TimeZone)
+	}
+	if drawsAtCount(eventInfo) {
 		confirmation += fmt.Sprintf("<b>开奖人数：</b> %d\n", eventInfo.NumberOfWinners)
 	}
-
-	//传递值
-	b.EventInfoMap[msg.Chat.ID] = eventInfo
+	confirmation += formatMinParticipantsHTML(eventInfo)
+	confirmation += formatClaimRuleHTML(eventInfo)
+	confirmation += formatEntryRulesHTML(eventInfo)
+	confirmation += formatCooldownRuleHTML(eventInfo)
 
 	// 添加“是”和“否”按钮用于确认发布抽奖活动
 	yesButton := tgbotapi.NewInlineKeyboardButtonData("是", "confirm_create_event")
@@ -176,7 +358,7 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(yesButton, noButton))
 
 	// 发送带有按钮的消息
-	editMsg := tgbotapi.NewMessage(msg.Chat.ID, confirmation)
+	editMsg := tgbotapi.NewMessage(chatID, confirmation)
 	editMsg.ParseMode = tgbotapi.ModeHTML
 	editMsg.ReplyMarkup = keyboard
 	if _, err := b.Bot.Send(editMsg); err != nil {
@@ -185,3 +367,41 @@ func (b *Bot) cmdCreate(msg *tgbotapi.Message) (err error) {
 	}
 	return nil
 }
+
+// 解析 /create 位置参数之后的 key=value 可选参数
+func parseCreateOptions(args []string) (map[string]string, error) {
+	supported := map[string]bool{"tiers": true, "group": true, "require": true, "min": true, "min_action": true,
+		"claim": true, "alternates": true, "referral": true,
+		"msg_entries": true, "vip": true, "cooldown": true, "cooldown_events": true, "monthly_cap": true}
+	options := make(map[string]string)
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		key, value, found := strings.Cut(arg, "=")
+		if !found || !supported[key] {
+			return nil, fmt.Errorf("不支持的可选参数: %s", arg)
+		}
+		options[key] = value
+	}
+	return options, nil
+}
+
+// 保存新建的活动并预留奖品，活动ID取确认发布的时间，
+// 多位管理员在同一秒内发布活动时，已存在的活动ID追加序号后重试，不会覆盖已有的活动
+func (b *Bot) createEvent(info *EventInformation) error {
+	baseID, err := newEventID()
+	if err != nil {
+		return err
+	}
+	for i := 1; ; i++ {
+		info.ID = baseID
+		if i > 1 {
+			info.ID = fmt.Sprintf("%s-%d", baseID, i)
+		}
+		err = b.store.CreateEvent(*info)
+		if !errors.Is(err, errEventIDExists) || i == maxEventIDAttempts {
+			return err
+		}
+	}
+}
@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdDelete(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin.")
-		if err != nil {
-			return err
-		}
+	if !b.checkPermission(msg, permManagePrizes) {
 		return nil
 	}
 
@@ -20,9 +16,9 @@ func (b *Bot) cmdDelete(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	args := strings.TrimSpace(msg.CommandArguments())
+	pool, args := parsePoolPrefix(strings.TrimSpace(msg.CommandArguments()))
 	if args == "" {
-		err := b.sendReply(msg, "/delete [需要删除的奖品，每个奖品用英文`分割]")
+		err := b.sendReply(msg, "/delete [#奖池（可选）] [需要删除的奖品，每个奖品用英文`分割]")
 		if err != nil {
 			return err
 		}
@@ -50,8 +46,8 @@ func (b *Bot) cmdDelete(msg *tgbotapi.Message) error {
 		return nil
 	}
 
-	//从奖品文件删除奖品
-	err := removePrizesFromPrizeTxtFile(validPrizes)
+	// 从库存删除奖品，重复的奖品每传入一次只删除一个
+	notFound, err := b.store.RemovePrizes(pool, validPrizes)
 	if err != nil {
 		log.Printf("Error removing prizes: %v", err)
 		err = b.sendReply(msg, "删除奖品失败")
@@ -61,10 +57,31 @@ func (b *Bot) cmdDelete(msg *tgbotapi.Message) error {
 		return err
 	}
 
-	response := fmt.Sprintf("<b>删除奖品成功！共 %d 个</b>\n删除的奖品：\n", len(validPrizes))
+	// 排除不在库存中的奖品，剩余的即为删除成功的奖品
+	missing := make(map[string]int)
+	for _, prize := range notFound {
+		missing[prize]++
+	}
+	var deletedPrizes []string
 	for _, prize := range validPrizes {
+		if missing[prize] > 0 {
+			missing[prize]--
+			continue
+		}
+		deletedPrizes = append(deletedPrizes, prize)
+	}
+
+	response := fmt.Sprintf("<b>删除奖品成功！共 %d 个</b>\n<b>奖池：</b> %s\n删除的奖品：\n",
+		len(deletedPrizes), tgbotapi.EscapeText(tgbotapi.ModeHTML, poolDisplayName(pool)))
+	for _, prize := range deletedPrizes {
 		response += fmt.Sprintf("%s,", tgbotapi.EscapeText(tgbotapi.ModeHTML, prize))
 	}
+	if len(notFound) > 0 {
+		response += "\n<b>以下奖品不在库存中：</b>\n"
+		for _, prize := range notFound {
+			response += fmt.Sprintf("%s,", tgbotapi.EscapeText(tgbotapi.ModeHTML, prize))
+		}
+	}
 
 	err = b.sendReplyHTML(msg, response)
 	if err != nil {
@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdHistory(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin")
-		if err != nil {
-			return fmt.Errorf("sendReply failed: %w", err)
-		}
+	if !b.checkPermission(msg, permView) {
 		return nil
 	}
 
@@ -20,24 +16,23 @@ func (b *Bot) cmdHistory(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
+	// 解析可选的群组和页码参数
+	group, args, err := b.parseGroupAndPage(msg.CommandArguments())
 	if err != nil {
-		return fmt.Errorf("initDB failed: %w", err)
+		return b.sendReply(msg, err.Error())
+	}
+	var groupID int64
+	if group != nil {
+		groupID = group.ID
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
 
 	//加载所有活动记录
-	b.allEvents, err = loadAllEvents(db)
+	allEvents, err := b.listHistoryEvents(groupID)
 	if err != nil {
-		return fmt.Errorf("loadAllEvents failed: %w", err)
+		return err
 	}
 
-	if len(b.allEvents) == 0 {
+	if len(allEvents) == 0 {
 		err = b.sendReply(msg, "no events found")
 		if err != nil {
 			return fmt.Errorf("sendReply failed: %w", err)
@@ -47,11 +42,10 @@ func (b *Bot) cmdHistory(msg *tgbotapi.Message) error {
 
 	page := 1
 	// 检查是否有页码参数
-	args := msg.CommandArguments()
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.allEvents) {
+		if err == nil && parsedPage > 0 && parsedPage <= len(allEvents) {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -63,12 +57,25 @@ func (b *Bot) cmdHistory(msg *tgbotapi.Message) error {
 		}
 	}
 	// 发送指定页码的消息
-	b.sendPageCmdHistory(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdHistory(msg.Chat.ID, 0, allEvents, groupID, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdHistory(chatID int64, messageID int, page int) {
-	totalPages := len(b.allEvents)
+// 全部活动，groupID 不为0时只保留属于该抽奖群的活动
+// 每次翻页都重新读取，多位管理员同时查看时互不影响
+func (b *Bot) listHistoryEvents(groupID int64) ([]EventInformation, error) {
+	allEvents, err := b.store.ListEvents()
+	if err != nil {
+		return nil, fmt.Errorf("ListEvents failed: %w", err)
+	}
+	if groupID != 0 {
+		allEvents = b.filterEventsByGroup(allEvents, groupID)
+	}
+	return allEvents, nil
+}
+
+func (b *Bot) sendPageCmdHistory(chatID int64, messageID int, allEvents []EventInformation, groupID int64, page int) {
+	totalPages := len(allEvents)
 
 	// 检查切片是否为空或页码是否超出范围
 	if totalPages == 0 {
@@ -89,15 +96,15 @@ func (b *Bot) sendPageCmdHistory(chatID int64, messageID int, page int) {
 		return
 	}
 
-	info := b.allEvents[page-1]
+	info := allEvents[page-1]
 
-	outputMsg, err := createAllEventInfoMsg(info)
+	outputMsg, err := b.createAllEventInfoMsg(info)
 	if err != nil {
 		log.Printf("createAllEventInfoMsg failed: %v", err)
 		return
 	}
 
-	keyBoard := b.generateCmdHistoryKeyboard(page, totalPages)
+	keyBoard := b.generateCmdHistoryKeyboard(page, totalPages, groupID)
 	if messageID == 0 {
 		msg := tgbotapi.NewMessage(chatID, outputMsg)
 		msg.ParseMode = tgbotapi.ModeHTML
@@ -117,7 +124,7 @@ func (b *Bot) sendPageCmdHistory(chatID int64, messageID int, page int) {
 	}
 }
 
-func (b *Bot) generateCmdHistoryKeyboard(currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
+func (b *Bot) generateCmdHistoryKeyboard(currentPage, totalPages int, groupID int64) tgbotapi.InlineKeyboardMarkup {
 	prevPage := currentPage - 1
 	nextPage := currentPage + 1
 
@@ -126,22 +133,22 @@ func (b *Bot) generateCmdHistoryKeyboard(currentPage, totalPages int) tgbotapi.I
 	if currentPage > 1 && currentPage < totalPages {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdHistoryPage"+strconv.Itoa(prevPage)),
+				tgbotapi.NewInlineKeyboardButtonData("上一页", groupPageData("cmdHistoryPage", prevPage, groupID)),
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdHistoryPage"+strconv.Itoa(nextPage)),
+				tgbotapi.NewInlineKeyboardButtonData("下一页", groupPageData("cmdHistoryPage", nextPage, groupID)),
 			),
 		)
 	} else if currentPage == 1 {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdHistoryPage"+strconv.Itoa(nextPage)),
+				tgbotapi.NewInlineKeyboardButtonData("下一页", groupPageData("cmdHistoryPage", nextPage, groupID)),
 			),
 		)
 	} else if currentPage == totalPages {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdHistoryPage"+strconv.Itoa(prevPage)),
+				tgbotapi.NewInlineKeyboardButtonData("上一页", groupPageData("cmdHistoryPage", prevPage, groupID)),
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
 			),
 		)
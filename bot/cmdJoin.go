@@ -1,27 +1,15 @@
 package bot
 
 import (
-	"fmt"
+	"errors"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"strings"
 )
 
 func (b *Bot) cmdJoin(msg *tgbotapi.Message) error {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("Unable to connect to database: %v", err)
-		return err
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("Failed to close database connection: %v", err)
-		}
-	}()
-
 	// 加载历史抽奖活动信息
-	eventInfo, err := loadAllEvents(db)
+	eventInfo, err := b.store.ListEvents()
 	if err != nil {
 		log.Printf("Unable to load all events: %v", err)
 		return err
@@ -60,6 +48,10 @@ func (b *Bot) cmdJoin(msg *tgbotapi.Message) error {
 				if msg.Chat.IsPrivate() {
 					return b.sendReply(msg, "请在群组中发送")
 				}
+				// 关键词只在活动所属的抽奖群中有效
+				if msg.Chat.ID != b.eventChatID(value) {
+					continue
+				}
 			} else if value.HowToParticipate == "2" { // 直接通过 /join 参与
 				if userKeyWord != "" {
 					continue
@@ -69,77 +61,60 @@ func (b *Bot) cmdJoin(msg *tgbotapi.Message) error {
 				}
 			}
 
-			// 检查用户是否已经参与过此活动
-			alreadyParticipated, err := hasParticipated(db, value.ID, userID)
+			// 检查参与条件
+			reason, err := b.checkJoinEligibility(value, userID)
 			if err != nil {
-				log.Printf("hasParticipated: %v", err)
-				err = b.sendReply(msg, fmt.Sprintf("你已经参与过活动: %v", value.ID))
+				log.Printf("checkJoinEligibility: %v", err)
+				return b.sendReply(msg, "暂时无法验证参与条件，请稍后再试")
+			}
+			if reason != "" {
+				err = b.sendReply(msg, reason)
 				if err != nil {
 					return err
 				}
-				return nil
+				continue
 			}
-			if !alreadyParticipated {
-				// 创建一个新的参与者项
-				newPartner := Partner{
-					UserID:   userID,
-					UserName: userName,
-				}
-
-				// 保存到数据库
-				err = saveParticipant(db, value.ID, newPartner)
-				if err != nil {
-					log.Printf("saveParticipant: %v", err)
-					return b.sendReply(msg, err.Error())
-				}
-
-				// 构建回复消息
-				var NumberOfParticipants int
-				var replyMessage string
-
-				replyMessage = fmt.Sprintf("🎉*你已成功参与活动:*🎉\n\n*🎟️ 活动 ID:* `%s`\n*🏷️ 活动名称:* %s\n*🎁 奖品数量:* %d\n",
-					value.ID, value.PrizeName, value.PrizeCount)
-
-				if value.PrizeResultMethod == "1" { // 按时间开奖
-					NumberOfParticipantsTime, err := getParticipantCountByEventID(db, value.ID)
-					if err != nil {
-						log.Printf(err.Error())
-					}
-					replyMessage += fmt.Sprintf("*⏰ 开奖时间:* %s %s\n*👥 参与人数:* %d\n", value.TimeOfWinners, config.TimeZone, NumberOfParticipantsTime)
-				} else if value.PrizeResultMethod == "2" { // 按人数开奖
-					NumberOfParticipants, err = getParticipantCountByEventID(db, value.ID)
-					if err != nil {
-						log.Printf(err.Error())
-					}
-					replyMessage += fmt.Sprintf("*🏆 开奖人数:* %d\n*👥 参与人数:* %d\n", value.NumberOfWinners, NumberOfParticipants)
 
-					// 人数到了自动开奖
-					if value.NumberOfWinners == NumberOfParticipants {
-						err = b.prizeDraw(value.ID)
-						if err != nil {
-							log.Printf("prizeDraw: %v", err)
-							return b.sendReply(msg, "❌ 参与者数量不足或系统出现严重错误，开奖失败，请联系管理员！")
-						}
-					}
-				}
-
-				if value.HowToParticipate == "1" {
-					replyMessage += fmt.Sprintf("*📲 参与方式:* %s\n*🔑 关键词:* `%s`\n", value.Participate, value.KeyWord)
-				} else if value.HowToParticipate == "2" {
-					replyMessage += fmt.Sprintf("*📲 参与方式:* %s\n", value.Participate)
-				}
-
-				// 发送 Markdown 格式的消息
-				err = b.sendReplyMarkDown(msg, replyMessage)
+			// 登记参与者
+			newPartner := Partner{
+				UserID:   userID,
+				UserName: userName,
+			}
+			joined, NumberOfParticipants, err := joinEvent(b.store, value, newPartner)
+			if errors.Is(err, errEventClosed) {
+				err = b.sendReply(msg, "活动已结束: "+value.ID)
 				if err != nil {
 					return err
 				}
-			} else {
+				continue
+			}
+			if err != nil {
+				log.Printf("joinEvent: %v", err)
+				return b.sendReply(msg, err.Error())
+			}
+			if !joined {
 				err = b.sendReply(msg, "你已经参与过活动: "+value.ID)
 				if err != nil {
 					log.Printf("send Reply err: %v", err)
 					return err
 				}
+				continue
+			}
+
+			// 构建回复消息
+			replyMessage := formatJoinReply(value, NumberOfParticipants)
+
+			// 人数到了自动开奖
+			_, err = b.drawIfThresholdReached(value, NumberOfParticipants)
+			if err != nil {
+				log.Printf("prizeDraw: %v", err)
+				return b.sendReply(msg, "❌ 参与者数量不足或系统出现严重错误，开奖失败，请联系管理员！")
+			}
+
+			// 发送 Markdown 格式的消息
+			err = b.sendReplyMarkDown(msg, replyMessage)
+			if err != nil {
+				return err
 			}
 		}
 	}
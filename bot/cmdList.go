@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdList(msg *tgbotapi.Message) (err error) {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin.")
-		if err != nil {
-			return err
-		}
+	if !b.checkPermission(msg, permView) {
 		return nil
 	}
 
@@ -20,7 +16,7 @@ func (b *Bot) cmdList(msg *tgbotapi.Message) (err error) {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	b.prizeList, err = loadPrizes()
+	prizeList, err := b.store.ListAvailablePrizes()
 	if err != nil {
 		log.Printf("loadPrizes err: %s", err)
 		err = b.sendReply(msg, "加载奖品失败！")
@@ -30,7 +26,7 @@ func (b *Bot) cmdList(msg *tgbotapi.Message) (err error) {
 		return nil
 	}
 
-	if len(b.prizeList) == 0 {
+	if len(prizeList) == 0 {
 		err = b.sendReply(msg, "没有奖品可显示")
 		if err != nil {
 			return err
@@ -46,7 +42,7 @@ func (b *Bot) cmdList(msg *tgbotapi.Message) (err error) {
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.prizeList) {
+		if err == nil && parsedPage > 0 && parsedPage <= len(prizeList) {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -59,12 +55,12 @@ func (b *Bot) cmdList(msg *tgbotapi.Message) (err error) {
 	}
 
 	// 发送指定页码的消息
-	b.sendPageCmdList(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdList(msg.Chat.ID, 0, prizeList, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdList(chatID int64, messageID int, page int) {
-	totalPrizes := len(b.prizeList)
+func (b *Bot) sendPageCmdList(chatID int64, messageID int, prizeList []Prize, page int) {
+	totalPrizes := len(prizeList)
 	totalPages := (totalPrizes + 9) / 10 // 计算总页数，每页10个奖品
 
 	// 检查切片是否为空或页码是否超出范围
@@ -94,10 +90,15 @@ func (b *Bot) sendPageCmdList(chatID int64, messageID int, page int) {
 	}
 
 	// 生成奖品列表字符串
-	outputMsg := fmt.Sprintf("<b>😊 加载成功</b>  共 <b>%d</b> 个奖品\n", len(b.prizeList))
+	outputMsg := fmt.Sprintf("<b>😊 加载成功</b>  共 <b>%d</b> 个奖品\n", len(prizeList))
 	for i := startIndex; i < endIndex; i++ {
 		// 使用 <li> 标签生成列表项，并将奖品名称进行转义
-		outputMsg += fmt.Sprintf("%d. %s\n", i+1, tgbotapi.EscapeText(tgbotapi.ModeHTML, b.prizeList[i]))
+		prize := prizeList[i]
+		if prize.Pool != "" {
+			outputMsg += fmt.Sprintf("%d. [%s] %s\n", i+1, tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.Pool), tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.Text))
+			continue
+		}
+		outputMsg += fmt.Sprintf("%d. %s\n", i+1, tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.Text))
 	}
 
 	keyBoard := b.generateCmdListKeyboard(page, totalPages)
@@ -8,11 +8,7 @@ import (
 )
 
 func (b *Bot) cmdOn(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin.")
-		if err != nil {
-			return fmt.Errorf("sendReply failed: %w", err)
-		}
+	if !b.checkPermission(msg, permView) {
 		return nil
 	}
 
@@ -20,24 +16,23 @@ func (b *Bot) cmdOn(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
+	// 解析可选的群组和页码参数
+	group, args, err := b.parseGroupAndPage(msg.CommandArguments())
 	if err != nil {
-		return fmt.Errorf("initDB failed: %w", err)
+		return b.sendReply(msg, err.Error())
+	}
+	var groupID int64
+	if group != nil {
+		groupID = group.ID
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
 
 	//加载未开奖和未取消的所有活动信息
-	b.onEvent, err = loadNoCancelAndNoOpenEvents(db)
+	onEvents, err := b.listOngoingEvents(groupID)
 	if err != nil {
-		return fmt.Errorf("loadNoCancelAndNoOpenEvents failed: %w", err)
+		return err
 	}
 
-	if len(b.onEvent) == 0 {
+	if len(onEvents) == 0 {
 		err = b.sendReply(msg, "没有正在进行的活动")
 		if err != nil {
 			return fmt.Errorf("sendReply failed: %w", err)
@@ -49,11 +44,10 @@ func (b *Bot) cmdOn(msg *tgbotapi.Message) error {
 	page := 1
 
 	// 检查是否有页码参数
-	args := msg.CommandArguments()
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.onEvent) {
+		if err == nil && parsedPage > 0 && parsedPage <= len(onEvents) {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -65,12 +59,25 @@ func (b *Bot) cmdOn(msg *tgbotapi.Message) error {
 		}
 	}
 	// 发送指定页码的消息
-	b.sendPageCmdOn(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdOn(msg.Chat.ID, 0, onEvents, groupID, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdOn(chatID int64, messageID int, page int) {
-	totalPages := len(b.onEvent)
+// 正在进行的活动，groupID 不为0时只保留属于该抽奖群的活动
+// 每次翻页都重新读取，多位管理员同时查看时互不影响
+func (b *Bot) listOngoingEvents(groupID int64) ([]EventInformation, error) {
+	onEvents, err := b.store.ListOngoingEvents()
+	if err != nil {
+		return nil, fmt.Errorf("ListOngoingEvents failed: %w", err)
+	}
+	if groupID != 0 {
+		onEvents = b.filterEventsByGroup(onEvents, groupID)
+	}
+	return onEvents, nil
+}
+
+func (b *Bot) sendPageCmdOn(chatID int64, messageID int, onEvents []EventInformation, groupID int64, page int) {
+	totalPages := len(onEvents)
 
 	// 检查切片是否为空或页码是否超出范围
 	if totalPages == 0 {
@@ -92,29 +99,17 @@ func (b *Bot) sendPageCmdOn(chatID int64, messageID int, page int) {
 	}
 
 	// 获取当前页的活动信息
-	info := b.onEvent[page-1]
+	info := onEvents[page-1]
 
-	outputMsg, err := createAllEventInfoMsg(info)
+	outputMsg, err := b.createAllEventInfoMsg(info)
 	if err != nil {
 		log.Printf("createAllEventInfoMsg err: %v", err)
 		return
 	}
 
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("initDB failed: %v", err)
-		return
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
-
-	partnerList, err := getParticipantsByEventID(db, info.ID)
+	partnerList, err := b.store.ListParticipants(info.ID)
 	if err != nil {
-		log.Printf("getParticipantsByEventID err: %v", err)
+		log.Printf("ListParticipants err: %v", err)
 		return
 	}
 
@@ -126,7 +121,7 @@ func (b *Bot) sendPageCmdOn(chatID int64, messageID int, page int) {
 	outputMsg += partnerString + "<b>正在进行的活动</b>\n"
 
 	// 创建内联键盘
-	keyboard := b.generateCmdOnKeyboard(page, totalPages)
+	keyboard := b.generateCmdOnKeyboard(page, totalPages, groupID)
 
 	if messageID == 0 {
 		// 发送初始消息
@@ -149,7 +144,7 @@ func (b *Bot) sendPageCmdOn(chatID int64, messageID int, page int) {
 	}
 }
 
-func (b *Bot) generateCmdOnKeyboard(currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
+func (b *Bot) generateCmdOnKeyboard(currentPage, totalPages int, groupID int64) tgbotapi.InlineKeyboardMarkup {
 	prevPage := currentPage - 1
 	nextPage := currentPage + 1
 
@@ -158,22 +153,22 @@ func (b *Bot) generateCmdOnKeyboard(currentPage, totalPages int) tgbotapi.Inline
 	if currentPage > 1 && currentPage < totalPages {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdOnPage"+strconv.Itoa(prevPage)),
+				tgbotapi.NewInlineKeyboardButtonData("上一页", groupPageData("cmdOnPage", prevPage, groupID)),
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdOnPage"+strconv.Itoa(nextPage)),
+				tgbotapi.NewInlineKeyboardButtonData("下一页", groupPageData("cmdOnPage", nextPage, groupID)),
 			),
 		)
 	} else if currentPage == 1 {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdOnPage"+strconv.Itoa(nextPage)),
+				tgbotapi.NewInlineKeyboardButtonData("下一页", groupPageData("cmdOnPage", nextPage, groupID)),
 			),
 		)
 	} else if currentPage == totalPages {
 		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
 			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdOnPage"+strconv.Itoa(prevPage)),
+				tgbotapi.NewInlineKeyboardButtonData("上一页", groupPageData("cmdOnPage", prevPage, groupID)),
 				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
 			),
 		)
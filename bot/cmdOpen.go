@@ -1,17 +1,15 @@
 package bot
 
 import (
+	"errors"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"strings"
 )
 
 func (b *Bot) cmdOpen(msg *tgbotapi.Message) error {
-	if !b.checkAdmin(msg) {
-		err := b.sendReply(msg, "You are not an admin")
-		if err != nil {
-			return err
-		}
+	if !b.checkPermission(msg, permManageEvents) {
 		return nil
 	}
 
@@ -19,23 +17,9 @@ func (b *Bot) cmdOpen(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中使用管理员指令")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "无法连接到数据库")
-		_, err := b.Bot.Send(reply)
-		return err
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
-		}
-	}()
-
 	args := strings.Split(msg.CommandArguments(), " ")
 	if len(args) == 0 || args[0] == "" {
-		err = b.sendReply(msg, "/open [活动ID]")
+		err := b.sendReply(msg, "/open [活动ID]")
 		if err != nil {
 			log.Printf("sendReply: %v", err)
 			return err
@@ -44,12 +28,17 @@ func (b *Bot) cmdOpen(msg *tgbotapi.Message) error {
 	}
 
 	inputID := args[0]
-	info, err := checkEventInformationFromId(db, inputID)
+	info, err := b.store.GetEvent(inputID)
 	if err != nil {
-		log.Printf("checkEventInformationFromId: %v", err)
+		log.Printf("GetEvent: %v", err)
 		return err
 	}
 
+	// 只能管理自己有权限的抽奖群中的活动
+	if !b.hasPermission(msg.From.ID, permManageEvents, b.eventChatID(info)) {
+		return b.sendReply(msg, "你没有管理此活动所属群组的权限")
+	}
+
 	if info.CancelStatus {
 		err = b.sendReply(msg, "此活动已取消，无法开奖")
 		if err != nil {
@@ -68,7 +57,7 @@ func (b *Bot) cmdOpen(msg *tgbotapi.Message) error {
 		return nil
 	}
 
-	outputMsg, err := createAllEventInfoMsg(info)
+	outputMsg, err := b.createAllEventInfoMsg(info)
 	if err != nil {
 		log.Printf("createAllEventInfoMsg: %v", err)
 	}
@@ -76,13 +65,25 @@ func (b *Bot) cmdOpen(msg *tgbotapi.Message) error {
 	err = b.prizeDraw(info.ID)
 	if err != nil {
 		log.Printf("PrizeDraw err %v\n", err)
-		if err.Error() == "参与者数量不足，无法开奖,活动已取消" {
+		if errors.Is(err, errInsufficientParticipants) {
 			err = b.sendReply(msg, "参与者数量不足，无法开奖,活动已取消")
 			if err != nil {
 				return err
 			}
 			return nil
 		}
+		if errors.Is(err, errDrawExtended) {
+			info, err = b.store.GetEvent(info.ID)
+			if err != nil {
+				log.Printf("GetEvent: %v", err)
+				return err
+			}
+			return b.sendReply(msg, fmt.Sprintf("参与者数量不足 %d 人，开奖时间已延长至 %s %s",
+				minParticipants(info), info.TimeOfWinners, config.TimeZone))
+		}
+		if errors.Is(err, errEventAlreadyOpened) {
+			return b.sendReply(msg, "此活动已经开奖，请勿重复开奖")
+		}
 		err = b.sendReply(msg, "手动开奖失败")
 		if err != nil {
 			log.Printf("send Reply msg err %v\n", err)
@@ -12,23 +12,12 @@ func (b *Bot) cmdPrize(msg *tgbotapi.Message) error {
 		return b.sendReply(msg, "请在私聊中发送")
 	}
 
-	// 初始化数据库
-	db, err := initDB()
+	winInfoList, err := b.store.ListWinsByUser(msg.From.ID)
 	if err != nil {
-		return fmt.Errorf("initDB failed: %w", err)
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
-
-	b.winInfoList, err = getWinInfoByUserID(db, msg.From.ID)
-	if err != nil {
-		return fmt.Errorf("getWinInfoByUserID failed: %w", err)
+		return fmt.Errorf("ListWinsByUser failed: %w", err)
 	}
 
-	if len(b.winInfoList) == 0 {
+	if len(winInfoList) == 0 {
 		err = b.sendReply(msg, "没有中奖记录")
 		if err != nil {
 			return fmt.Errorf("sendReply failed: %w", err)
@@ -44,7 +33,7 @@ func (b *Bot) cmdPrize(msg *tgbotapi.Message) error {
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.winInfoList) {
+		if err == nil && parsedPage > 0 && parsedPage <= len(winInfoList) {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -56,24 +45,12 @@ func (b *Bot) cmdPrize(msg *tgbotapi.Message) error {
 		}
 	}
 	// 发送指定页码的消息
-	b.sendPageCmdPrize(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdPrize(msg.Chat.ID, 0, winInfoList, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdPrize(chatID int64, messageID int, page int) {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("initDB failed: %v", err)
-		return
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
-
-	totalPages := len(b.winInfoList)
+func (b *Bot) sendPageCmdPrize(chatID int64, messageID int, winInfoList []winInfo, page int) {
+	totalPages := len(winInfoList)
 
 	// 检查切片是否为空或页码是否超出范围
 	if totalPages == 0 {
@@ -95,11 +72,11 @@ func (b *Bot) sendPageCmdPrize(chatID int64, messageID int, page int) {
 	}
 
 	// 获取当前页的活动信息
-	info := b.winInfoList[page-1]
+	info := winInfoList[page-1]
 
-	NumberOfParticipants, err := getParticipantCountByEventID(db, info.ID)
+	NumberOfParticipants, err := b.store.CountParticipants(info.ID)
 	if err != nil {
-		log.Printf("getParticipantCountByEventID failed: %v", err)
+		log.Printf("CountParticipants failed: %v", err)
 	}
 
 	outputMsg := fmt.Sprintf("🎉*你中奖的活动:*🎉\n\n*🎟️ 活动 ID:* `%s`\n*🏷️ 活动名称:* %s\n*🎁 奖品数量:* %d\n",
@@ -107,14 +84,25 @@ func (b *Bot) sendPageCmdPrize(chatID int64, messageID int, page int) {
 	if info.PrizeResultMethod == "1" { // 按时间开奖
 		outputMsg += fmt.Sprintf("*⏰ 开奖时间:* %s %s\n*👥 参与人数:* %d\n", info.TimeOfWinners, config.TimeZone, NumberOfParticipants)
 	} else if info.PrizeResultMethod == "2" { // 按人数开奖
-		NumberOfParticipants, err = getParticipantCountByEventID(db, info.ID)
+		NumberOfParticipants, err = b.store.CountParticipants(info.ID)
 		if err != nil {
 			log.Printf(err.Error())
 		}
 		outputMsg += fmt.Sprintf("*🏆 开奖人数:* %d\n*👥 参与人数:* %d\n", info.NumberOfWinners, NumberOfParticipants)
 
+	} else if info.PrizeResultMethod == "3" { // 按时间或人数开奖
+		outputMsg += fmt.Sprintf("*⏰ 开奖时间:* %s %s\n*🏆 开奖人数:* %d\n*👥 参与人数:* %d\n",
+			info.TimeOfWinners, config.TimeZone, info.NumberOfWinners, NumberOfParticipants)
+	}
+	if info.TierName != "" {
+		outputMsg += fmt.Sprintf("*🏅 奖项：* %v\n", info.TierName)
+	}
+	// 待领取的奖品在领取后才显示
+	if info.ClaimStatus == claimStatusPending {
+		outputMsg += fmt.Sprintf("*🎁奖品：* 待领取，请在 %s %s 前点击中奖通知中的领取按钮", formatDBTime(info.ClaimDeadline), config.TimeZone)
+	} else {
+		outputMsg += fmt.Sprintf("*🎁奖品：* %v", info.PrizeInfo)
 	}
-	outputMsg += fmt.Sprintf("*🎁奖品：* %v", info.PrizeInfo)
 
 	// 创建内联键盘
 	keyboard := b.generateCmdPrizeKeyboard(page, totalPages)
@@ -4,28 +4,36 @@ import (
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// /see 每页显示的活动数量
+const seePageSize = 5
+
+// 用户在某个活动中的参与情况
+type userEventStatus struct {
+	participation Participation
+	joined        bool
+	entries       int      // 抽奖次数
+	prizes        []string // 中奖的奖品，设置了奖项时带有奖项名称
+}
+
 func (b *Bot) cmdSee(msg *tgbotapi.Message) error {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		return fmt.Errorf("initDB failed: %w", err)
+	// 参与情况中包含中奖的奖品，只在私聊中显示
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中发送")
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("close db err: %v", err)
-		}
-	}()
 
 	//加载用户参与过的所有活动信息
-	b.userJoinEvents, err = GetUserEventsByUserID(db, msg.From.ID)
+	userJoinEvents, err := b.store.ListEventsByParticipant(msg.From.ID)
 	if err != nil {
-		return fmt.Errorf("GetUserEventsByUserID failed: %w", err)
+		return fmt.Errorf("ListEventsByParticipant failed: %w", err)
 	}
 
-	if len(b.userJoinEvents) == 0 {
+	if len(userJoinEvents) == 0 {
 		err = b.sendReply(msg, "你尚未参与任何活动")
 		if err != nil {
 			return fmt.Errorf("sendReply failed: %w", err)
@@ -34,13 +42,14 @@ func (b *Bot) cmdSee(msg *tgbotapi.Message) error {
 	}
 	// 默认页码为1
 	page := 1
+	totalPages := (len(userJoinEvents) + seePageSize - 1) / seePageSize
 
 	// 检查是否有页码参数
 	args := msg.CommandArguments()
 	if args != "" {
 		// 尝试解析页码
 		parsedPage, err := strconv.Atoi(args)
-		if err == nil && parsedPage > 0 && parsedPage <= len(b.userJoinEvents) {
+		if err == nil && parsedPage > 0 && parsedPage <= totalPages {
 			page = parsedPage
 		} else {
 			// 如果解析失败，返回一个错误提示
@@ -52,12 +61,108 @@ func (b *Bot) cmdSee(msg *tgbotapi.Message) error {
 		}
 	}
 	// 发送指定页码的消息
-	b.sendPageCmdSee(msg.Chat.ID, 0, page) // 传递 messageID 为 0，表示新消息
+	b.sendPageCmdSee(msg.Chat.ID, 0, msg.From.ID, page) // 传递 messageID 为 0，表示新消息
 	return nil
 }
 
-func (b *Bot) sendPageCmdSee(chatID int64, messageID int, page int) {
-	totalPages := len(b.userJoinEvents)
+// 查询用户在活动中的参与记录和中奖的奖品
+func (b *Bot) getUserEventStatus(info EventInformation, userID int64) (status userEventStatus, err error) {
+	status.participation, status.joined, err = b.store.GetParticipation(info.ID, userID)
+	if err != nil {
+		return userEventStatus{}, err
+	}
+	if status.joined {
+		status.entries, err = b.userEntries(info, userID, status.participation)
+		if err != nil {
+			return userEventStatus{}, err
+		}
+	}
+	if !info.OpenStatus {
+		return status, nil
+	}
+
+	luckyUserList, err := b.store.ListWinners(info.ID)
+	if err != nil {
+		return userEventStatus{}, err
+	}
+	for _, luckyUser := range luckyUserList {
+		if luckyUser.UserID != userID {
+			continue
+		}
+		// 待领取的奖品在领取后才显示
+		prize := luckyUser.PrizeInfo
+		if luckyUser.ClaimStatus == claimStatusPending {
+			prize = fmt.Sprintf("待领取（截止 %s）", formatDBTime(luckyUser.ClaimDeadline))
+		}
+		if luckyUser.TierName != "" {
+			status.prizes = append(status.prizes, luckyUser.TierName+"："+prize)
+		} else {
+			status.prizes = append(status.prizes, prize)
+		}
+	}
+	return status, nil
+}
+
+// 将数据库中的时间（UTC）转换为配置的时区显示
+func formatDBTime(dbTime string) string {
+	if dbTime == "" {
+		return "未知"
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", dbTime)
+	if err != nil {
+		return dbTime
+	}
+	timeLoc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		log.Printf("load timezone error: %v", err)
+		return dbTime
+	}
+	return t.In(timeLoc).Format("2006-01-02 15:04:05")
+}
+
+// 用户在活动中的结果：未开奖、已取消、未中奖或中奖的奖品
+func formatUserEventResult(info EventInformation, status userEventStatus) string {
+	switch {
+	case info.CancelStatus:
+		return "活动已取消"
+	case !info.OpenStatus:
+		return "未开奖"
+	case len(status.prizes) > 0:
+		return "🎉 已中奖：" + tgbotapi.EscapeText(tgbotapi.ModeHTML, strings.Join(status.prizes, "、"))
+	default:
+		return "未中奖"
+	}
+}
+
+// 生成用户参与情况的描述：结果、抽奖资格、参与时间和参与顺序
+func formatUserEventStatus(info EventInformation, status userEventStatus) string {
+	text := fmt.Sprintf("<b>结果：</b> %s\n", formatUserEventResult(info, status))
+	if !status.participation.Eligible {
+		text += fmt.Sprintf("<b>抽奖资格：</b> 已失去（%s）\n",
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, status.participation.IneligibleReason))
+	}
+	text += fmt.Sprintf("<b>参与时间：</b> %s %s\n<b>参与顺序：</b> 第 %d 位\n",
+		formatDBTime(status.participation.JoinedAt), config.TimeZone, status.participation.Position)
+	if hasEntryRules(info) || status.entries != 1 {
+		text += fmt.Sprintf("<b>抽奖次数：</b> %d\n", status.entries)
+	}
+	if info.ReferralCap > 0 {
+		text += fmt.Sprintf("<b>邀请人数：</b> %d（最多增加 %d 次抽奖机会）\n", status.participation.Referrals, info.ReferralCap)
+	}
+	return text
+}
+
+func (b *Bot) sendPageCmdSee(chatID int64, messageID int, userID int64, page int) {
+	userJoinEvents, err := b.store.ListEventsByParticipant(userID)
+	if err != nil {
+		log.Printf("ListEventsByParticipant failed: %v", err)
+		return
+	}
+	// 最近参与的活动在前
+	sort.Slice(userJoinEvents, func(i, j int) bool {
+		return userJoinEvents[i].ID > userJoinEvents[j].ID
+	})
+	totalPages := (len(userJoinEvents) + seePageSize - 1) / seePageSize
 
 	// 检查切片是否为空或页码是否超出范围
 	if totalPages == 0 {
@@ -79,16 +184,43 @@ func (b *Bot) sendPageCmdSee(chatID int64, messageID int, page int) {
 	}
 
 	// 获取当前页的活动信息
-	info := b.userJoinEvents[page-1]
+	start := (page - 1) * seePageSize
+	end := start + seePageSize
+	if end > len(userJoinEvents) {
+		end = len(userJoinEvents)
+	}
 
-	outputMsg, err := createUserSeeEventInfoMsg(info)
-	if err != nil {
-		log.Printf("createUserSeeEventInfoMsg failed: %v", err)
+	outputMsg := fmt.Sprintf("<b>你参与过的活动</b>（共 %d 个）\n", len(userJoinEvents))
+	var detailButtons []tgbotapi.InlineKeyboardButton
+	for i, info := range userJoinEvents[start:end] {
+		index := start + i + 1
+		status, err := b.getUserEventStatus(info, userID)
+		if err != nil {
+			log.Printf("getUserEventStatus failed: %v", err)
+			continue
+		}
+		outputMsg += fmt.Sprintf("\n<b>%d. %s</b> <code>%s</code>\n%s｜第 %d 位参与｜%s",
+			index,
+			tgbotapi.EscapeText(tgbotapi.ModeHTML, info.PrizeName),
+			info.ID,
+			formatUserEventResult(info, status),
+			status.participation.Position,
+			formatDBTime(status.participation.JoinedAt),
+		)
+		if hasEntryRules(info) || status.entries != 1 {
+			outputMsg += fmt.Sprintf("｜抽奖次数 %d", status.entries)
+		}
+		if info.ReferralCap > 0 {
+			outputMsg += fmt.Sprintf("｜邀请 %d 人", status.participation.Referrals)
+		}
+		outputMsg += "\n"
+		detailButtons = append(detailButtons, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("详情 %d", index), fmt.Sprintf("seeDetail_%s_%d", info.ID, page)))
 	}
-	outputMsg += "你参与过的活动\n"
+	outputMsg += "\n点击下方按钮查看活动详情"
 
 	// 创建内联键盘
-	keyboard := b.generateCmdSeeKeyboard(page, totalPages)
+	keyboard := b.generateCmdSeeKeyboard(detailButtons, page, totalPages)
 
 	if messageID == 0 {
 		// 发送初始消息
@@ -111,35 +243,63 @@ func (b *Bot) sendPageCmdSee(chatID int64, messageID int, page int) {
 	}
 }
 
-func (b *Bot) generateCmdSeeKeyboard(currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
-	prevPage := currentPage - 1
-	nextPage := currentPage + 1
+// 显示用户参与的单个活动的详情，page 为返回列表时的页码
+func (b *Bot) sendSeeDetail(chatID int64, messageID int, userID int64, eventID string, page int) {
+	info, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return
+	}
+	status, err := b.getUserEventStatus(info, userID)
+	if err != nil {
+		log.Printf("getUserEventStatus failed: %v", err)
+		return
+	}
+	if !status.joined {
+		log.Printf("user %d has not joined event %s", userID, eventID)
+		return
+	}
 
-	var inlineKeyboard tgbotapi.InlineKeyboardMarkup
+	outputMsg, err := b.createUserSeeEventInfoMsg(info)
+	if err != nil {
+		log.Printf("createUserSeeEventInfoMsg failed: %v", err)
+	}
+	outputMsg += "\n<b>你的参与情况</b>\n" + formatUserEventStatus(info, status)
+	// 进行中的活动附带邀请链接
+	if info.ReferralCap > 0 && !info.OpenStatus && !info.CancelStatus {
+		outputMsg += fmt.Sprintf("<b>邀请链接：</b> <code>%s</code>\n", b.referralLink(info.ID, userID))
+	}
 
-	if currentPage > 1 && currentPage < totalPages {
-		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdSeePage"+strconv.Itoa(prevPage)),
-				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdSeePage"+strconv.Itoa(nextPage)),
-			),
-		)
-	} else if currentPage == 1 {
-		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-				tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdSeePage"+strconv.Itoa(nextPage)),
-			),
-		)
-	} else if currentPage == totalPages {
-		inlineKeyboard = tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdSeePage"+strconv.Itoa(prevPage)),
-				tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"),
-			),
-		)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("返回列表", "cmdSeePage"+strconv.Itoa(page)),
+	))
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, outputMsg)
+	editMsg.ParseMode = tgbotapi.ModeHTML
+	editMsg.ReplyMarkup = &keyboard
+	_, err = b.Bot.Send(editMsg)
+	if err != nil {
+		log.Printf("sendMessage failed: %v", err)
+	}
+}
+
+func (b *Bot) generateCmdSeeKeyboard(detailButtons []tgbotapi.InlineKeyboardButton, currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if len(detailButtons) > 0 {
+		rows = append(rows, detailButtons)
+	}
+
+	// 只有一页时不显示翻页按钮
+	if totalPages > 1 {
+		var pageRow []tgbotapi.InlineKeyboardButton
+		if currentPage > 1 {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdSeePage"+strconv.Itoa(currentPage-1)))
+		}
+		pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"))
+		if currentPage < totalPages {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdSeePage"+strconv.Itoa(currentPage+1)))
+		}
+		rows = append(rows, pageRow)
 	}
 
-	return inlineKeyboard
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
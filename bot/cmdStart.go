@@ -2,14 +2,28 @@ package bot
 
 import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
 )
 
 func (b *Bot) cmdStart(msg *tgbotapi.Message) error {
+	// 通过 t.me/<机器人>?start=<参数> 链接启动时附带的参数
+	payload := msg.CommandArguments()
+	if strings.HasPrefix(payload, "claim_") {
+		return b.startClaim(msg, strings.TrimPrefix(payload, "claim_"))
+	}
+	if strings.HasPrefix(payload, "join_") {
+		return b.startJoin(msg, strings.TrimPrefix(payload, "join_"))
+	}
+	if strings.HasPrefix(payload, "ref_") {
+		return b.startReferral(msg, strings.TrimPrefix(payload, "ref_"))
+	}
+
 	response := `🎉 *欢迎使用抽奖机器人！* 🎉
 
 /id - 查看你自己的用户ID
 
 📜 **管理员指令**
+/admin [add/remove/list] - 管理管理员及其角色（仅所有者）
 *开奖方法：*
 1. 按时间开奖  
 2. 按人数开奖
@@ -18,7 +32,9 @@ func (b *Bot) cmdStart(msg *tgbotapi.Message) error {
 1. 群组内发送关键词参与  
 2. 私聊机器人参与
 
-/create [活动名称] [奖品数量] [开奖方法1/2] [选1填时间，选2填人数] [参与方法1/2] [选1填关键词，选2填 私聊机器人参与] - 创建一个新的抽奖活动
+/create - 不带参数时进入分步创建向导，按提示逐步填写
+/cancel\_wizard - 退出创建向导
+/create [活动名称] [奖品数量] [开奖方法1/2] [选1填时间，选2填人数] [参与方法1/2] [选1填关键词，选2填 私聊机器人参与] - 一次性创建一个新的抽奖活动
 
 *命令示例：*
 ` + "`" + `/create 我要抽奖 10 1 20240823-23:07 1 抽奖` + "`" + `
@@ -26,22 +42,33 @@ func (b *Bot) cmdStart(msg *tgbotapi.Message) error {
 ` + "`" + `/create 我要抽奖 10 2 30 1 抽奖` + "`" + `
 ` + "`" + `/create 我要抽奖 10 2 30 2 私聊机器人参与` + "`" + `
 
-/add - 添加奖品  
-/delete - 删除奖品  
+*多奖项（可选参数）：* tiers=名称:数量[:奖池],...
+` + "`" + `/create 我要抽奖 14 1 20240823-23:07 1 抽奖 tiers=一等奖:1:大奖,二等奖:3,参与奖:10` + "`" + `
+
+/add [#奖池（可选）] - 添加奖品  
+/delete [#奖池（可选）] - 删除奖品  
 /list - 查看库存中的所有奖品  
-/on [指定页码（可选）]- 查看正在进行的活动
+/on [群组（可选）] [指定页码（可选）]- 查看正在进行的活动
 /cancel [指定页码（可选）] - 查看已取消的活动
-/history [指定页码（可选）] - 查看历史抽奖活动
+/history [群组（可选）] [指定页码（可选）] - 查看历史抽奖活动
 /open [活动ID] - 手动开奖  
 /close [活动ID] - 关闭正在进行的活动
+/undelivered [指定页码（可选）] - 查看未送达的中奖通知并重新发送
+/weights [活动ID] - 导入参与者的基础抽奖次数（CSV：用户ID,抽奖次数）
+/ban [用户ID] [event=活动ID（可选）] [for=时长（可选）] [原因（可选）] - 禁止用户参与活动
+/unban [用户ID] [event=活动ID（可选）] - 解除禁止
+/banlist [指定页码（可选）] - 查看被禁止参与的用户
 
 📋 **参与者指令**
 /see [指定页码（可选）] - 查看已参与的活动
-/join - 参加参与方式为“私聊机器人参与”的抽奖活动  
+/join - 参加参与方式为“私聊机器人参与”的抽奖活动，也可以点击活动公告中的链接参与指定的活动  
 /join [关键词] - 参加参与方式为“群组内发送关键词”的抽奖活动
 
 🎁 **领取奖品**  
-/prize [指定页码（可选）] - 查看中奖历史`
+/prize [指定页码（可选）] - 查看中奖历史
+
+🔍 **公平性验证**
+/verify [活动ID] - 使用公布的开奖种子复算并验证中奖结果`
 
 	err := b.sendMarkDown(msg, response)
 	if err != nil {
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// /undelivered 每页显示的中奖记录数量
+const undeliveredPageSize = 5
+
+// 未送达的中奖记录及所属活动
+type undeliveredPrize struct {
+	winner    LuckyUser
+	eventInfo EventInformation
+}
+
+func (b *Bot) cmdUndelivered(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permManageEvents) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	// 默认页码为1
+	page := 1
+	if args := msg.CommandArguments(); args != "" {
+		parsedPage, err := strconv.Atoi(args)
+		if err != nil || parsedPage < 1 {
+			return b.sendReply(msg, "无效的页码，非正整数或超出范围")
+		}
+		page = parsedPage
+	}
+
+	// 发送指定页码的消息
+	b.sendPageCmdUndelivered(msg.Chat.ID, 0, msg.From.ID, page) // 传递 messageID 为 0，表示新消息
+	return nil
+}
+
+// 查找用户有权管理的抽奖群中未送达的中奖记录
+func (b *Bot) listUndeliveredPrizes(userID int64) ([]undeliveredPrize, error) {
+	winners, err := b.store.ListUndelivered()
+	if err != nil {
+		return nil, err
+	}
+	events := make(map[string]EventInformation)
+	var prizes []undeliveredPrize
+	for _, winner := range winners {
+		eventInfo, ok := events[winner.EventID]
+		if !ok {
+			eventInfo, err = b.store.GetEvent(winner.EventID)
+			if err != nil {
+				log.Printf("GetEvent: %v", err)
+				continue
+			}
+			events[winner.EventID] = eventInfo
+		}
+		if !b.hasPermission(userID, permManageEvents, b.eventChatID(eventInfo)) {
+			continue
+		}
+		prizes = append(prizes, undeliveredPrize{winner: winner, eventInfo: eventInfo})
+	}
+	return prizes, nil
+}
+
+func (b *Bot) sendPageCmdUndelivered(chatID int64, messageID int, userID int64, page int) {
+	prizes, err := b.listUndeliveredPrizes(userID)
+	if err != nil {
+		log.Printf("listUndeliveredPrizes failed: %v", err)
+		return
+	}
+	totalPages := (len(prizes) + undeliveredPageSize - 1) / undeliveredPageSize
+
+	var outputMsg string
+	var resendButtons []tgbotapi.InlineKeyboardButton
+	if totalPages == 0 {
+		outputMsg = "所有中奖通知均已送达"
+	} else {
+		// 重发后记录可能减少，页码超出范围时显示最后一页
+		page = min(max(page, 1), totalPages)
+		start := (page - 1) * undeliveredPageSize
+		end := min(start+undeliveredPageSize, len(prizes))
+
+		outputMsg = fmt.Sprintf("<b>未送达的中奖通知</b>（共 %d 条）\n", len(prizes))
+		for i, prize := range prizes[start:end] {
+			index := start + i + 1
+			status := "待发送"
+			if prize.winner.DeliveryStatus == deliveryStatusFailed {
+				status = "发送失败：" + tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.winner.DeliveryError)
+			}
+			outputMsg += fmt.Sprintf("\n<b>%d. %s</b> <code>%s</code>\n@%s (<code>%d</code>)｜%s\n",
+				index,
+				tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.eventInfo.PrizeName),
+				prize.eventInfo.ID,
+				tgbotapi.EscapeText(tgbotapi.ModeHTML, prize.winner.UserName),
+				prize.winner.UserID,
+				status,
+			)
+			resendButtons = append(resendButtons, tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("重发 %d", index), fmt.Sprintf("resend_%d_%d", prize.winner.ID, page)))
+		}
+		outputMsg += "\n中奖者需要先私聊机器人才能收到通知，点击下方按钮重新发送"
+	}
+
+	keyboard := b.generateCmdUndeliveredKeyboard(resendButtons, page, totalPages)
+
+	if messageID == 0 {
+		msg := tgbotapi.NewMessage(chatID, outputMsg)
+		msg.ParseMode = tgbotapi.ModeHTML
+		if len(keyboard.InlineKeyboard) > 0 {
+			msg.ReplyMarkup = keyboard
+		}
+		_, err := b.Bot.Send(msg)
+		if err != nil {
+			log.Printf("sendMessage failed: %v", err)
+		}
+	} else {
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, outputMsg)
+		editMsg.ParseMode = tgbotapi.ModeHTML
+		editMsg.ReplyMarkup = &keyboard
+		_, err := b.Bot.Send(editMsg)
+		if err != nil {
+			log.Printf("sendMessage failed: %v", err)
+		}
+	}
+}
+
+func (b *Bot) generateCmdUndeliveredKeyboard(resendButtons []tgbotapi.InlineKeyboardButton, currentPage, totalPages int) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	if len(resendButtons) > 0 {
+		rows = append(rows, resendButtons)
+	}
+
+	// 只有一页时不显示翻页按钮
+	if totalPages > 1 {
+		var pageRow []tgbotapi.InlineKeyboardButton
+		if currentPage > 1 {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("上一页", "cmdUndeliveredPage"+strconv.Itoa(currentPage-1)))
+		}
+		pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData(strconv.Itoa(currentPage)+"/"+strconv.Itoa(totalPages), "noop"))
+		if currentPage < totalPages {
+			pageRow = append(pageRow, tgbotapi.NewInlineKeyboardButtonData("下一页", "cmdUndeliveredPage"+strconv.Itoa(currentPage+1)))
+		}
+		rows = append(rows, pageRow)
+	}
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// 处理重发按钮，结果以弹出提示的方式告知管理员，之后刷新列表
+func (b *Bot) handleResendCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	answer := func(text string) {
+		if _, err := b.Bot.Request(tgbotapi.NewCallback(callbackQuery.ID, text)); err != nil {
+			log.Printf("Error sending callback: %v", err)
+		}
+	}
+
+	// resend_<中奖记录ID>_<返回的页码>
+	idStr, pageStr, ok := strings.Cut(strings.TrimPrefix(callbackQuery.Data, "resend_"), "_")
+	winnerID, idErr := strconv.ParseInt(idStr, 10, 64)
+	page, pageErr := strconv.Atoi(pageStr)
+	if !ok || idErr != nil || pageErr != nil {
+		log.Printf("Invalid resend data: %s", callbackQuery.Data)
+		answer("此按钮已失效")
+		return
+	}
+	winner, err := b.store.GetWinner(winnerID)
+	if err != nil {
+		log.Printf("GetWinner: %v", err)
+		answer("中奖记录不存在")
+		return
+	}
+	eventInfo, err := b.store.GetEvent(winner.EventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		answer("活动不存在")
+		return
+	}
+	if !b.hasPermission(callbackQuery.From.ID, permManageEvents, b.eventChatID(eventInfo)) {
+		answer("你没有管理此活动所属群组的权限")
+		return
+	}
+
+	switch {
+	case winner.ClaimStatus == claimStatusExpired:
+		answer("中奖者已逾期未领取，无需重发")
+	case winner.DeliveryStatus == deliveryStatusDelivered:
+		answer("中奖通知已送达")
+	default:
+		err = b.deliverWinnerNotice(eventInfo, winner)
+		if err != nil {
+			log.Printf("无法发送消息给用户 %d: %v", winner.UserID, err)
+			answer("发送失败：" + err.Error())
+		} else {
+			answer("✅ 已发送")
+		}
+	}
+	b.sendPageCmdUndelivered(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, callbackQuery.From.ID, page)
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strings"
+)
+
+func (b *Bot) cmdVerify(msg *tgbotapi.Message) error {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		return b.sendReply(msg, "/verify [活动ID]")
+	}
+
+	info, err := b.store.GetEvent(args[0])
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return b.sendReply(msg, "活动不存在")
+	}
+
+	if !info.OpenStatus || info.Seed == "" {
+		return b.sendReply(msg, "此活动尚未开奖，开奖种子将在开奖时公布")
+	}
+
+	partnerList, err := b.store.ListParticipants(info.ID)
+	if err != nil {
+		return fmt.Errorf("ListParticipants failed: %w", err)
+	}
+	// 使用开奖时记录的抽奖次数，旧版本开奖的活动没有记录，按邀请人数计算
+	if !hasStoredEntries(partnerList) {
+		partnerList = applyEntries(info, partnerList, entrySources{})
+	}
+
+	records, err := b.store.ListWinnerRecords(info.ID)
+	if err != nil {
+		return fmt.Errorf("ListWinnerRecords failed: %w", err)
+	}
+	// 只比对开奖时抽出的中奖者，递补的候补与候补名单比对
+	var luckyUserList []LuckyUser
+	for _, record := range records {
+		if record.AlternatePosition == 0 {
+			luckyUserList = append(luckyUserList, record)
+		}
+	}
+	alternateList, err := b.store.ListAlternates(info.ID)
+	if err != nil {
+		return fmt.Errorf("ListAlternates failed: %w", err)
+	}
+
+	// 使用公布的种子复算中奖者，并与记录的中奖者逐一比对
+	winners := pickWinners(info.Seed, partnerList, info.PrizeCount)
+	matched := len(winners) == len(luckyUserList)
+	for i := 0; matched && i < len(winners); i++ {
+		if winners[i].UserID != luckyUserList[i].UserID {
+			matched = false
+		}
+	}
+	// 候补紧接在中奖者之后，同样逐一比对
+	var alternates []Partner
+	if len(alternateList) > 0 {
+		alternates = pickAlternates(info.Seed, partnerList, len(winners), info.AlternateCount)
+		matched = matched && len(alternates) == len(alternateList)
+		for i := 0; matched && i < len(alternates); i++ {
+			if alternates[i].UserID != alternateList[i].UserID {
+				matched = false
+			}
+		}
+	}
+
+	commitmentOK := seedCommitment(info.Seed) == info.SeedCommitment
+
+	outputMsg := fmt.Sprintf("<b>活动ID：</b> <code>%s</code>\n<b>开奖种子：</b> <code>%s</code>\n<b>种子承诺：</b> <code>%s</code>\n",
+		info.ID, info.Seed, info.SeedCommitment)
+	if commitmentOK {
+		outputMsg += "<b>承诺校验：</b> ✅ SHA256(种子) 与发布时的承诺一致\n"
+	} else {
+		outputMsg += "<b>承诺校验：</b> ❌ SHA256(种子) 与发布时的承诺不一致\n"
+	}
+	outputMsg += fmt.Sprintf("<b>参与人数：</b> %d\n<b>复算中奖者：</b>\n", len(partnerList))
+	for i, winner := range winners {
+		outputMsg += fmt.Sprintf("%d. @%s (<code>%d</code>)\n", i+1, tgbotapi.EscapeText(tgbotapi.ModeHTML, winner.UserName), winner.UserID)
+	}
+	if len(alternates) > 0 {
+		outputMsg += "<b>复算候补：</b>\n"
+		for i, alternate := range alternates {
+			outputMsg += fmt.Sprintf("%d. @%s (<code>%d</code>)", i+1, tgbotapi.EscapeText(tgbotapi.ModeHTML, alternate.UserName), alternate.UserID)
+			if i < len(alternateList) && alternateList[i].Promoted {
+				outputMsg += " 已递补"
+			}
+			outputMsg += "\n"
+		}
+	}
+	if matched {
+		outputMsg += "<b>结果校验：</b> ✅ 复算结果与公布的中奖名单一致\n"
+	} else {
+		outputMsg += "<b>结果校验：</b> ❌ 复算结果与公布的中奖名单不一致\n"
+	}
+	outputMsg += "\n<b>算法：</b> 参与者按参与时间排序；第 n 个随机数为 SHA256(\"种子:n\") 前 8 字节的大端整数（n 从 0 开始），" +
+		"超出 m 的整数倍范围时丢弃重取，取模 m 得到 [0, m) 内的整数；从最后一位 i 开始与第 intn(i+1) 位交换完成洗牌，前 奖品数量 位即为中奖者，" +
+		"其后的 候补人数 位依次为候补。"
+	if hasWeightedEntries(partnerList) {
+		outputMsg += "\n有参与者获得了额外的抽奖次数，本活动按抽奖次数加权抽取：每次取 intn(剩余参与者的抽奖次数之和)，" +
+			"按参与顺序累加抽奖次数，第一个累计值大于该数的参与者被抽出并移出列表，依次抽出中奖者和候补。"
+	}
+
+	err = b.sendReplyHTML(msg, outputMsg)
+	if err != nil {
+		return err
+	}
+
+	// 发送按参与时间排序的参与者列表，便于任何人独立复算
+	var list strings.Builder
+	list.WriteString("position,user_id,user_name,entries\n")
+	for i, partner := range partnerList {
+		list.WriteString(fmt.Sprintf("%d,%d,%s,%d\n", i, partner.UserID, partner.UserName, partner.Entries))
+	}
+	document := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("participants_%s.csv", info.ID),
+		Bytes: []byte(list.String()),
+	})
+	document.Caption = "按参与时间排序的参与者列表及抽奖次数"
+	document.ReplyToMessageID = msg.MessageID
+	if _, err := b.Bot.Send(document); err != nil {
+		return fmt.Errorf("send participants document failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"encoding/csv"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导入的 CSV 文件大小上限
+const maxWeightsFileSize = 1 << 20
+
+const weightsUsage = "/weights [活动ID] - 导入参与者的基础抽奖次数（默认为1）\n" +
+	"CSV 每行为 用户ID,抽奖次数，可以写在指令的下一行，也可以作为文件发送并以指令作为文件说明\n" +
+	"/weights [活动ID] clear - 清除已导入的抽奖次数"
+
+// cmdWeights 导入活动参与者的基础抽奖次数，再次导入会替换之前导入的内容
+func (b *Bot) cmdWeights(msg *tgbotapi.Message) error {
+	if !b.checkPermission(msg, permManageEvents) {
+		return nil
+	}
+
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中使用管理员指令")
+	}
+
+	// 指令可以写在文本消息中，也可以写在文件说明中
+	text := msg.Text
+	if msg.Document != nil {
+		text = msg.Caption
+	}
+	header, body, _ := strings.Cut(text, "\n")
+	args := strings.Fields(header)
+	if len(args) < 2 {
+		return b.sendReply(msg, weightsUsage)
+	}
+
+	info, err := b.store.GetEvent(args[1])
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return b.sendReply(msg, "活动不存在: "+args[1])
+	}
+	if !b.hasPermission(msg.From.ID, permManageEvents, b.eventChatID(info)) {
+		return b.sendReply(msg, "你没有管理此活动所属群组的权限")
+	}
+	if info.OpenStatus || info.CancelStatus {
+		return b.sendReply(msg, "活动已结束，无法修改抽奖次数: "+info.ID)
+	}
+
+	if len(args) > 2 && args[2] == "clear" {
+		err = b.store.ReplaceEntryWeights(info.ID, nil)
+		if err != nil {
+			log.Printf("ReplaceEntryWeights: %v", err)
+			return b.sendReply(msg, "清除失败，请稍后再试")
+		}
+		return b.sendReply(msg, "已清除活动 "+info.ID+" 导入的抽奖次数")
+	}
+
+	if msg.Document != nil {
+		body, err = b.downloadDocument(msg.Document)
+		if err != nil {
+			log.Printf("downloadDocument: %v", err)
+			return b.sendReply(msg, err.Error())
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		weights, err := b.store.ListEntryWeights(info.ID)
+		if err != nil {
+			log.Printf("ListEntryWeights: %v", err)
+			return b.sendReply(msg, "暂时无法获取抽奖次数，请稍后再试")
+		}
+		return b.sendReply(msg, fmt.Sprintf("活动 %s 已导入 %d 位用户的抽奖次数\n\n%s", info.ID, len(weights), weightsUsage))
+	}
+
+	weights, err := parseEntryWeights(body)
+	if err != nil {
+		return b.sendReply(msg, err.Error())
+	}
+	err = b.store.ReplaceEntryWeights(info.ID, weights)
+	if err != nil {
+		log.Printf("ReplaceEntryWeights: %v", err)
+		return b.sendReply(msg, "导入失败，请稍后再试")
+	}
+	return b.sendReply(msg, fmt.Sprintf("已为活动 %s 导入 %d 位用户的基础抽奖次数，开奖时生效", info.ID, len(weights)))
+}
+
+// 解析 用户ID,抽奖次数 格式的 CSV，第一行不是数字时视为表头跳过
+func parseEntryWeights(data string) (map[int64]int, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %v", err)
+	}
+
+	weights := make(map[int64]int)
+	for i, record := range records {
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("第 %d 行格式错误，应为 用户ID,抽奖次数", i+1)
+		}
+		userID, err := strconv.ParseInt(strings.TrimSpace(record[0]), 10, 64)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("第 %d 行的用户ID无效: %s", i+1, record[0])
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("第 %d 行的抽奖次数必须是正整数: %s", i+1, record[1])
+		}
+		weights[userID] = weight
+	}
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("没有可导入的抽奖次数")
+	}
+	return weights, nil
+}
+
+// 下载用户发送的文件内容
+func (b *Bot) downloadDocument(document *tgbotapi.Document) (string, error) {
+	if document.FileSize > maxWeightsFileSize {
+		return "", fmt.Errorf("文件过大，最大 %d KB", maxWeightsFileSize>>10)
+	}
+	fileURL, err := b.Bot.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return "", fmt.Errorf("无法获取文件: %v", err)
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("下载文件失败: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("close response body err: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载文件失败: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWeightsFileSize))
+	if err != nil {
+		return "", fmt.Errorf("下载文件失败: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 活动是否设置了中奖冷却规则
+func hasCooldownRules(info EventInformation) bool {
+	return info.CooldownDays > 0 || info.CooldownEvents > 0 || info.MonthlyWinCap > 0
+}
+
+// 新建的活动默认使用配置文件中的中奖冷却规则，规则随活动保存，之后修改配置不影响已创建的活动
+func applyDefaultCooldown(info *EventInformation) {
+	info.CooldownDays = max(config.WinnerCooldown.Days, 0)
+	info.CooldownEvents = max(config.WinnerCooldown.Events, 0)
+	info.MonthlyWinCap = max(config.WinnerCooldown.MonthlyCap, 0)
+}
+
+// 本月第一天零点（配置的时区），转换为数据库中的 UTC 时间
+func monthStart(now time.Time) (string, error) {
+	timeZone, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return "", fmt.Errorf("error loading timezone: %v", err)
+	}
+	local := now.In(timeZone)
+	start := time.Date(local.Year(), local.Month(), 1, 0, 0, 0, 0, timeZone)
+	return start.UTC().Format(dbTimeLayout), nil
+}
+
+// 按活动的中奖冷却规则查询开奖时需要排除的用户及原因，同时符合多条规则时只记录第一条
+func cooldownExclusions(store WinnerStore, info EventInformation, now time.Time) (map[int64]string, error) {
+	excluded := make(map[int64]string)
+	exclude := func(wins map[int64]int, minWins int, reason string) {
+		for userID, count := range wins {
+			if _, ok := excluded[userID]; !ok && count >= minWins {
+				excluded[userID] = reason
+			}
+		}
+	}
+
+	if info.CooldownDays > 0 {
+		since := now.UTC().AddDate(0, 0, -info.CooldownDays).Format(dbTimeLayout)
+		wins, err := store.CountWinsSince(since)
+		if err != nil {
+			return nil, err
+		}
+		exclude(wins, 1, fmt.Sprintf("%d 天内已中奖", info.CooldownDays))
+	}
+	if info.CooldownEvents > 0 {
+		wins, err := store.CountWinsInRecentEvents(info.CooldownEvents)
+		if err != nil {
+			return nil, err
+		}
+		exclude(wins, 1, fmt.Sprintf("最近 %d 场活动中已中奖", info.CooldownEvents))
+	}
+	if info.MonthlyWinCap > 0 {
+		since, err := monthStart(now)
+		if err != nil {
+			return nil, err
+		}
+		wins, err := store.CountWinsSince(since)
+		if err != nil {
+			return nil, err
+		}
+		exclude(wins, info.MonthlyWinCap, fmt.Sprintf("本月已中奖 %d 次", info.MonthlyWinCap))
+	}
+	return excluded, nil
+}
+
+// 从参与者中移除需要排除的用户，返回仍具备资格的参与者和被排除的参与者及原因
+func excludeParticipants(partners []Partner, reasons map[int64]string) (eligible []Partner, excluded map[int64]string) {
+	excluded = make(map[int64]string)
+	for _, partner := range partners {
+		if reason, ok := reasons[partner.UserID]; ok {
+			excluded[partner.UserID] = reason
+			continue
+		}
+		eligible = append(eligible, partner)
+	}
+	return eligible, excluded
+}
+
+// 生成中奖冷却规则的说明，未设置规则的活动不显示
+func formatCooldownRuleHTML(info EventInformation) string {
+	if !hasCooldownRules(info) {
+		return ""
+	}
+	var rules []string
+	if info.CooldownDays > 0 {
+		rules = append(rules, fmt.Sprintf("%d 天内中过奖", info.CooldownDays))
+	}
+	if info.CooldownEvents > 0 {
+		rules = append(rules, fmt.Sprintf("最近 %d 场活动中中过奖", info.CooldownEvents))
+	}
+	if info.MonthlyWinCap > 0 {
+		rules = append(rules, fmt.Sprintf("本月已中奖 %d 次", info.MonthlyWinCap))
+	}
+	return "<b>中奖冷却：</b> " + strings.Join(rules, "、") + "的用户开奖时不参与抽奖\n"
+}
+
+// 开奖后告知管理员因退出频道或群组、被禁止参与或中奖冷却规则被排除的参与者人数
+func (b *Bot) reportDrawExclusions(info EventInformation, excluded map[int64]string) {
+	if len(excluded) == 0 {
+		return
+	}
+	counts := make(map[string]int)
+	for _, reason := range excluded {
+		counts[reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	text := fmt.Sprintf("活动 %s（<code>%s</code>）开奖时有 %d 位参与者不具备抽奖资格：\n",
+		tgbotapi.EscapeText(tgbotapi.ModeHTML, info.PrizeName), info.ID, len(excluded))
+	for _, reason := range reasons {
+		text += fmt.Sprintf("%s：%d 人\n", reason, counts[reason])
+	}
+	msg := tgbotapi.NewMessage(config.AdminUserID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	if _, err := b.Bot.Send(msg); err != nil {
+		log.Printf("无法通知管理员活动 %s 被排除的参与者: %v", info.ID, err)
+	}
+}
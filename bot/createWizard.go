@@ -0,0 +1,466 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// 创建活动向导的步骤，保存在 UserStates 中
+const (
+	wizardStateGroup      = "wizard_group"       // 选择抽奖群
+	wizardStateName       = "wizard_name"        // 输入活动名称
+	wizardStatePrizeCount = "wizard_prize_count" // 输入奖品数量或奖项设置
+	wizardStateDrawMethod = "wizard_draw_method" // 选择开奖方式
+	wizardStateDrawTime   = "wizard_draw_time"   // 输入开奖时间
+	wizardStateDrawCount  = "wizard_draw_count"  // 输入开奖人数
+	wizardStateMinCount   = "wizard_min_count"   // 输入最少参与人数
+	wizardStateMinAction  = "wizard_min_action"  // 选择人数不足时的处理方式
+	wizardStateClaim      = "wizard_claim"       // 输入领取期限
+	wizardStateJoinMethod = "wizard_join_method" // 选择参与方式
+	wizardStateKeyword    = "wizard_keyword"     // 输入抽奖关键词
+	wizardStateRequire    = "wizard_require"     // 输入参与者必须加入的频道或群组
+	wizardStateConfirm    = "wizard_confirm"     // 等待确认发布
+)
+
+// 设置用户的向导步骤和活动草稿，并保存到数据库以便重启后继续
+func (b *Bot) setWizardState(userID int64, state string, info EventInformation) error {
+	b.userStatesMu.Lock()
+	b.UserStates[userID] = state
+	b.userStatesMu.Unlock()
+
+	b.eventInfoMapMu.Lock()
+	b.EventInfoMap[userID] = info
+	b.eventInfoMapMu.Unlock()
+
+	return b.store.SaveWizardState(userID, state, info)
+}
+
+// 获取用户当前的向导步骤和活动草稿
+func (b *Bot) getWizardState(userID int64) (state string, info EventInformation, ok bool) {
+	b.userStatesMu.Lock()
+	state, ok = b.UserStates[userID]
+	b.userStatesMu.Unlock()
+	if !ok {
+		return "", EventInformation{}, false
+	}
+
+	b.eventInfoMapMu.Lock()
+	info = b.EventInfoMap[userID]
+	b.eventInfoMapMu.Unlock()
+	return state, info, true
+}
+
+// 清理用户的向导状态
+func (b *Bot) clearWizardState(userID int64) {
+	b.userStatesMu.Lock()
+	delete(b.UserStates, userID)
+	b.userStatesMu.Unlock()
+
+	b.eventInfoMapMu.Lock()
+	delete(b.EventInfoMap, userID)
+	b.eventInfoMapMu.Unlock()
+
+	if err := b.store.DeleteWizardState(userID); err != nil {
+		log.Printf("DeleteWizardState failed: %v", err)
+	}
+}
+
+// 发送向导提示，所有提示都带有取消按钮
+func (b *Bot) sendWizardPrompt(chatID int64, text string, rows ...[]tgbotapi.InlineKeyboardButton) error {
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("取消创建", "wizard_cancel")))
+	message := tgbotapi.NewMessage(chatID, text)
+	message.ParseMode = tgbotapi.ModeHTML
+	message.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, err := b.Bot.Send(message)
+	return err
+}
+
+// 开始分步创建活动
+func (b *Bot) startCreateWizard(msg *tgbotapi.Message) error {
+	eventInfo, err := b.newEventDraft()
+	if err != nil {
+		return err
+	}
+
+	title := "🧙 <b>创建抽奖活动</b>\n随时发送 /cancel_wizard 退出向导\n\n"
+
+	// 只能选择有权限发布活动的抽奖群，只有一个时无需选择
+	groups := b.permittedGroups(msg.From.ID)
+	if len(groups) == 0 {
+		return b.sendReply(msg, "你没有在任何群组发布活动的权限")
+	}
+	if len(groups) == 1 {
+		setEventGroup(&eventInfo, groups[0])
+		err = b.setWizardState(msg.From.ID, wizardStateName, eventInfo)
+		if err != nil {
+			return fmt.Errorf("error saving wizard state: %v", err)
+		}
+		return b.sendWizardPrompt(msg.Chat.ID, title+"<b>第 1 步：</b>请输入活动名称")
+	}
+
+	err = b.setWizardState(msg.From.ID, wizardStateGroup, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, group := range groups {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(group.Title, "wizard_group_"+strconv.FormatInt(group.ID, 10)),
+		))
+	}
+	return b.sendWizardPrompt(msg.Chat.ID, title+"请选择发布活动的抽奖群", rows...)
+}
+
+// 处理向导中用户输入的文本，返回是否已处理
+func (b *Bot) handleWizardInput(msg *tgbotapi.Message) (bool, error) {
+	if !msg.Chat.IsPrivate() {
+		return false, nil
+	}
+
+	state, eventInfo, ok := b.getWizardState(msg.From.ID)
+	if !ok {
+		return false, nil
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	switch state {
+	case wizardStateName:
+		if text == "" {
+			return true, b.sendReply(msg, "活动名称不能为空，请重新输入")
+		}
+		eventInfo.PrizeName = text
+		return true, b.promptWizardPrizeCount(msg, eventInfo)
+
+	case wizardStatePrizeCount:
+		return true, b.handleWizardPrizeCount(msg, eventInfo, text)
+
+	case wizardStateDrawTime:
+		if err := CheckTime(text); err != nil {
+			return true, b.sendReply(msg, err.Error()+"，请重新输入")
+		}
+		eventInfo.TimeOfWinners = text
+		// 按时间或人数开奖时还需输入开奖人数
+		if drawsAtCount(eventInfo) {
+			return true, b.promptWizardDrawCount(msg.Chat.ID, msg.From.ID, eventInfo)
+		}
+		return true, b.promptWizardMinCount(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateDrawCount:
+		count, err := strconv.Atoi(text)
+		if err != nil || count < eventInfo.PrizeCount {
+			return true, b.sendReply(msg, fmt.Sprintf("开奖人数必须是不小于奖品数量 %d 的整数，请重新输入", eventInfo.PrizeCount))
+		}
+		eventInfo.NumberOfWinners = count
+		return true, b.promptWizardMinCount(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateMinCount:
+		count, err := strconv.Atoi(text)
+		if err != nil || count < 1 {
+			return true, b.sendReply(msg, "最少参与人数必须是正整数，请重新输入")
+		}
+		eventInfo.MinParticipants = count
+		if err = checkMinParticipantsRule(eventInfo); err != nil {
+			return true, b.sendReply(msg, err.Error()+"，请重新输入")
+		}
+		return true, b.promptWizardMinAction(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateClaim:
+		hours, err := strconv.Atoi(text)
+		if err != nil || hours < 1 {
+			return true, b.sendReply(msg, "领取期限必须是正整数（小时），请重新输入")
+		}
+		// 每个奖品有一位候补
+		eventInfo.ClaimHours, eventInfo.AlternateCount = hours, eventInfo.PrizeCount
+		return true, b.promptWizardJoinMethod(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateKeyword:
+		if text == "" || len(strings.Fields(text)) != 1 {
+			return true, b.sendReply(msg, "关键词不能为空且不能包含空格，请重新输入")
+		}
+		eventInfo.KeyWord = text
+		return true, b.promptWizardRequire(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateRequire:
+		chats, err := b.parseRequiredChats(text)
+		if err != nil {
+			return true, b.sendReply(msg, err.Error()+"，请重新输入")
+		}
+		eventInfo.RequiredChats = chats
+		return true, b.finishCreateWizard(msg.Chat.ID, msg.From.ID, eventInfo)
+
+	case wizardStateGroup, wizardStateDrawMethod, wizardStateMinAction, wizardStateJoinMethod, wizardStateConfirm:
+		return true, b.sendReply(msg, "请点击上方的按钮进行选择，或发送 /cancel_wizard 退出向导")
+	}
+	return false, nil
+}
+
+func (b *Bot) promptWizardPrizeCount(msg *tgbotapi.Message, eventInfo EventInformation) error {
+	prizes, err := b.store.ListAvailablePrizes()
+	if err != nil {
+		return fmt.Errorf("error loading prizes: %v", err)
+	}
+
+	// 统计各奖池剩余的奖品数量
+	var pools []string
+	poolCount := make(map[string]int)
+	for _, prize := range prizes {
+		if _, ok := poolCount[prize.Pool]; !ok {
+			pools = append(pools, prize.Pool)
+		}
+		poolCount[prize.Pool]++
+	}
+	inventory := ""
+	for _, pool := range pools {
+		inventory += fmt.Sprintf("%s：%d 个\n", tgbotapi.EscapeText(tgbotapi.ModeHTML, poolDisplayName(pool)), poolCount[pool])
+	}
+	if inventory == "" {
+		inventory = "库存中没有奖品，请先使用 /add 添加奖品\n"
+	}
+
+	err = b.setWizardState(msg.From.ID, wizardStatePrizeCount, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(msg.Chat.ID, "<b>第 2 步：</b>请输入奖品数量，奖品从默认奖池中选取；\n"+
+		"或输入奖项设置 <code>名称:数量[:奖池],...</code>，例如 <code>一等奖:1:大奖,二等奖:3,参与奖:10</code>\n\n"+
+		"<b>当前库存：</b>\n"+inventory)
+}
+
+func (b *Bot) handleWizardPrizeCount(msg *tgbotapi.Message, eventInfo EventInformation, text string) error {
+	var tiers []PrizeTier
+	if count, err := strconv.Atoi(text); err == nil {
+		if count < 1 {
+			return b.sendReply(msg, "奖品数量必须大于0，请重新输入")
+		}
+		tiers = []PrizeTier{{Count: count}}
+	} else {
+		tiers, err = parseTiers(text)
+		if err != nil {
+			return b.sendReply(msg, err.Error()+"，请重新输入")
+		}
+	}
+
+	prizes, err := b.store.ListAvailablePrizes()
+	if err != nil {
+		return fmt.Errorf("error loading prizes: %v", err)
+	}
+
+	err = choosePrizesForTiers(prizes, tiers)
+	if err != nil {
+		return b.sendReply(msg, err.Error()+"，请重新输入")
+	}
+	eventInfo.AllPrizes = prizeTexts(prizes)
+	eventInfo.Tiers = tiers
+	eventInfo.ChoosePrizes = tiersPrizes(tiers)
+	eventInfo.PrizeCount = tiersPrizeCount(tiers)
+
+	err = b.setWizardState(msg.From.ID, wizardStateDrawMethod, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(msg.Chat.ID, "<b>第 3 步：</b>请选择开奖方式",
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("按时间开奖", "wizard_draw_1"),
+			tgbotapi.NewInlineKeyboardButtonData("按人数开奖", "wizard_draw_2"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("按时间或人数开奖", "wizard_draw_3"),
+		))
+}
+
+func (b *Bot) promptWizardDrawCount(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateDrawCount, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	text := fmt.Sprintf("<b>第 4 步：</b>请输入开奖人数，参与人数达到后自动开奖（不小于奖品数量 %d）", eventInfo.PrizeCount)
+	if drawsAtTime(eventInfo) {
+		text = fmt.Sprintf("请输入开奖人数，开奖时间到达或参与人数达到时开奖，先到者为准（不小于奖品数量 %d）", eventInfo.PrizeCount)
+	}
+	return b.sendWizardPrompt(chatID, text)
+}
+
+func (b *Bot) promptWizardMinCount(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateMinCount, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(chatID, fmt.Sprintf("<b>第 5 步：</b>请输入开奖所需的最少参与人数，并在下一步选择人数不足时的处理方式；"+
+		"点击跳过则与奖品数量相同（%d），人数不足时取消活动", eventInfo.PrizeCount),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("跳过", "wizard_min_skip")))
+}
+
+func (b *Bot) promptWizardMinAction(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateMinAction, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	row := tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("取消活动", "wizard_min_cancel"))
+	// 只有按时间开奖的活动可以延长开奖时间
+	if drawsAtTime(eventInfo) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("延长 %d 小时", defaultExtendHours), "wizard_min_extend"))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("照常开奖", "wizard_min_draw"))
+	return b.sendWizardPrompt(chatID, fmt.Sprintf("开奖时参与人数不足 %d 人时如何处理？\n"+
+		"选择照常开奖时，如果奖品多于参与人数，所有参与者都会中奖，剩余的奖品退回库存", eventInfo.MinParticipants), row)
+}
+
+func (b *Bot) promptWizardClaim(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateClaim, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(chatID, fmt.Sprintf("<b>第 6 步：</b>如需中奖者在期限内私聊机器人点击领取奖品，请输入领取期限（小时），"+
+		"逾期未领取的奖品依次递补给候补（候补 %d 人）；不需要则点击跳过，中奖后直接发放奖品", eventInfo.PrizeCount),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("跳过", "wizard_claim_skip")))
+}
+
+func (b *Bot) promptWizardJoinMethod(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateJoinMethod, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(chatID, "<b>第 7 步：</b>请选择参与方式",
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("群组内发送关键词", "wizard_join_1"),
+			tgbotapi.NewInlineKeyboardButtonData("私聊机器人参与", "wizard_join_2"),
+		))
+}
+
+func (b *Bot) promptWizardRequire(chatID int64, userID int64, eventInfo EventInformation) error {
+	err := b.setWizardState(userID, wizardStateRequire, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendWizardPrompt(chatID, "<b>最后一步：</b>如需参与者先加入指定的频道或群组，请输入其用户名或会话ID，多个用英文逗号分割，"+
+		"例如 <code>@channel,-1001234567890</code>；机器人需要是这些频道或群组的管理员。不需要则点击跳过",
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("跳过", "wizard_require_skip")))
+}
+
+// 完成所有步骤，发送待确认的活动信息
+func (b *Bot) finishCreateWizard(chatID int64, userID int64, eventInfo EventInformation) error {
+	eventInfo.PrizesList = formatTierPrizesList(eventInfo.Tiers)
+
+	err := b.setWizardState(userID, wizardStateConfirm, eventInfo)
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return b.sendCreateConfirmation(chatID, eventInfo)
+}
+
+// 处理向导中的按钮
+func (b *Bot) handleWizardCallback(callbackQuery *tgbotapi.CallbackQuery) error {
+	data := callbackQuery.Data
+	userID := callbackQuery.From.ID
+	chatID := callbackQuery.Message.Chat.ID
+
+	if data == "wizard_cancel" {
+		b.clearWizardState(userID)
+		b.markWizardChoice(callbackQuery, "已取消创建")
+		return nil
+	}
+
+	state, eventInfo, ok := b.getWizardState(userID)
+	if !ok {
+		b.markWizardChoice(callbackQuery, "向导已失效，请重新发送 /create")
+		return nil
+	}
+
+	switch {
+	case state == wizardStateGroup && strings.HasPrefix(data, "wizard_group_"):
+		group, ok := b.findGroup(strings.TrimPrefix(data, "wizard_group_"))
+		if !ok || !b.hasPermission(userID, permManageEvents, group.ID) {
+			b.markWizardChoice(callbackQuery, "此按钮已失效")
+			return nil
+		}
+		setEventGroup(&eventInfo, group)
+		b.markWizardChoice(callbackQuery, eventInfo.GroupName)
+		err := b.setWizardState(userID, wizardStateName, eventInfo)
+		if err != nil {
+			return fmt.Errorf("error saving wizard state: %v", err)
+		}
+		return b.sendWizardPrompt(chatID, "<b>第 1 步：</b>请输入活动名称")
+
+	case state == wizardStateDrawMethod && (data == "wizard_draw_1" || data == "wizard_draw_3"):
+		eventInfo.PrizeResultMethod = strings.TrimPrefix(data, "wizard_draw_")
+		eventInfo.PrizeResult = drawMethodNames[eventInfo.PrizeResultMethod]
+		b.markWizardChoice(callbackQuery, eventInfo.PrizeResult)
+		err := b.setWizardState(userID, wizardStateDrawTime, eventInfo)
+		if err != nil {
+			return fmt.Errorf("error saving wizard state: %v", err)
+		}
+		return b.sendWizardPrompt(chatID, fmt.Sprintf("<b>第 4 步：</b>请输入开奖时间，格式为 <code>20240823-23:07</code>（时区 %s）", config.TimeZone))
+
+	case state == wizardStateDrawMethod && data == "wizard_draw_2":
+		eventInfo.PrizeResultMethod = "2"
+		eventInfo.PrizeResult = drawMethodNames[eventInfo.PrizeResultMethod]
+		b.markWizardChoice(callbackQuery, eventInfo.PrizeResult)
+		return b.promptWizardDrawCount(chatID, userID, eventInfo)
+
+	case state == wizardStateMinCount && data == "wizard_min_skip":
+		eventInfo.MinParticipants, eventInfo.MinAction, eventInfo.ExtendHours = 0, "", 0
+		b.markWizardChoice(callbackQuery, "与奖品数量相同，人数不足时取消活动")
+		return b.promptWizardClaim(chatID, userID, eventInfo)
+
+	case state == wizardStateMinAction && strings.HasPrefix(data, "wizard_min_"):
+		var err error
+		eventInfo.MinAction, eventInfo.ExtendHours, err = parseMinAction(strings.TrimPrefix(data, "wizard_min_"))
+		if err != nil || checkMinParticipantsRule(eventInfo) != nil {
+			b.markWizardChoice(callbackQuery, "此按钮已失效")
+			return nil
+		}
+		b.markWizardChoice(callbackQuery, minActionText(eventInfo))
+		return b.promptWizardClaim(chatID, userID, eventInfo)
+
+	case state == wizardStateClaim && data == "wizard_claim_skip":
+		eventInfo.ClaimHours, eventInfo.AlternateCount = 0, 0
+		b.markWizardChoice(callbackQuery, "中奖后直接发放奖品")
+		return b.promptWizardJoinMethod(chatID, userID, eventInfo)
+
+	case state == wizardStateJoinMethod && data == "wizard_join_1":
+		eventInfo.HowToParticipate = "1"
+		eventInfo.Participate = "群组内发送关键词"
+		b.markWizardChoice(callbackQuery, eventInfo.Participate)
+		err := b.setWizardState(userID, wizardStateKeyword, eventInfo)
+		if err != nil {
+			return fmt.Errorf("error saving wizard state: %v", err)
+		}
+		return b.sendWizardPrompt(chatID, "<b>第 8 步：</b>请输入抽奖关键词，群成员发送此关键词即可参与")
+
+	case state == wizardStateJoinMethod && data == "wizard_join_2":
+		eventInfo.HowToParticipate = "2"
+		eventInfo.Participate = "私聊机器人参与"
+		eventInfo.KeyWord = ""
+		b.markWizardChoice(callbackQuery, eventInfo.Participate)
+		return b.promptWizardRequire(chatID, userID, eventInfo)
+
+	case state == wizardStateRequire && data == "wizard_require_skip":
+		eventInfo.RequiredChats = nil
+		b.markWizardChoice(callbackQuery, "无参与条件")
+		return b.finishCreateWizard(chatID, userID, eventInfo)
+	}
+
+	b.markWizardChoice(callbackQuery, "此按钮已失效")
+	return nil
+}
+
+// 在向导提示消息中记录用户的选择并移除按钮
+func (b *Bot) markWizardChoice(callbackQuery *tgbotapi.CallbackQuery, choice string) {
+	text := callbackQuery.Message.Text + "\n✅ " + choice
+	editMsg := tgbotapi.NewEditMessageText(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, text)
+	if _, err := b.Bot.Send(editMsg); err != nil {
+		log.Printf("edit wizard message failed: %v", err)
+	}
+}
+
+func (b *Bot) cmdCancelWizard(msg *tgbotapi.Message) error {
+	if _, _, ok := b.getWizardState(msg.From.ID); !ok {
+		return b.sendReply(msg, "当前没有正在进行的创建向导")
+	}
+	b.clearWizardState(msg.From.ID)
+	return b.sendReply(msg, "已退出创建向导")
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strings"
+)
+
+// 发送中奖通知并记录送达状态
+func (b *Bot) deliverWinnerNotice(eventInfo EventInformation, user LuckyUser) error {
+	status, reason := deliveryStatusDelivered, ""
+	sendErr := b.sendWinnerNotice(eventInfo, user)
+	if sendErr != nil {
+		status, reason = deliveryStatusFailed, sendErr.Error()
+	}
+	if err := b.store.SetDeliveryStatus(user.ID, status, reason); err != nil {
+		log.Printf("SetDeliveryStatus: %v", err)
+	}
+	return sendErr
+}
+
+// 未收到中奖通知的中奖者通过此链接启动机器人领取
+func (b *Bot) claimDeepLink(eventID string) string {
+	return fmt.Sprintf("https://t.me/%s?start=claim_%s", b.Bot.Self.UserName, eventID)
+}
+
+// 生成中奖通知未送达的说明，提醒中奖者通过链接启动机器人
+func (b *Bot) formatUndeliveredHTML(eventID string, undelivered []LuckyUser) string {
+	if len(undelivered) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(undelivered))
+	for _, user := range undelivered {
+		names = append(names, "@"+tgbotapi.EscapeText(tgbotapi.ModeHTML, user.UserName))
+	}
+	return fmt.Sprintf("⚠️ 以下中奖者未能收到中奖通知，请点击 <a href=\"%s\">此链接</a> 启动机器人领取：\n%s\n",
+		b.claimDeepLink(eventID), strings.Join(names, "\n"))
+}
+
+// 中奖者通过 start=claim_<活动ID> 启动机器人时，重新发送该活动的中奖通知
+func (b *Bot) startClaim(msg *tgbotapi.Message, eventID string) error {
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中发送")
+	}
+	eventInfo, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return b.sendReply(msg, "活动不存在: "+eventID)
+	}
+	winners, err := b.store.ListWinners(eventID)
+	if err != nil {
+		log.Printf("ListWinners: %v", err)
+		return b.sendReply(msg, "暂时无法获取中奖信息，请稍后再试")
+	}
+
+	var found bool
+	for _, winner := range winners {
+		if winner.UserID != msg.From.ID {
+			continue
+		}
+		found = true
+		err = b.deliverWinnerNotice(eventInfo, winner)
+		if err != nil {
+			log.Printf("无法发送消息给用户 %d: %v", winner.UserID, err)
+			return err
+		}
+	}
+	if !found {
+		return b.sendReply(msg, "你没有在此活动中奖: "+eventID)
+	}
+	return nil
+}
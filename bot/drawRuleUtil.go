@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 开奖时参与人数不足最少参与人数的处理方式
+const (
+	minActionCancel = "cancel" // 取消活动
+	minActionExtend = "extend" // 延长开奖时间，只适用于按时间开奖的活动
+	minActionDraw   = "draw"   // 照常开奖，奖品多于参与人数时全员中奖，未抽出的奖品退回库存
+)
+
+// 未设置延长时间时，人数不足延长开奖时间的小时数
+const defaultExtendHours = 24
+
+// 开奖时间的格式，时区为配置的时区
+const openTimeLayout = "20060102-15:04"
+
+// 开奖方式的说明
+var drawMethodNames = map[string]string{
+	"1": "按时间开奖",
+	"2": "按人数开奖",
+	"3": "按时间或人数开奖",
+}
+
+// 活动是否在开奖时间到达时开奖
+func drawsAtTime(info EventInformation) bool {
+	return info.PrizeResultMethod == "1" || info.PrizeResultMethod == "3"
+}
+
+// 活动是否在参与人数达到开奖人数时开奖
+func drawsAtCount(info EventInformation) bool {
+	return info.PrizeResultMethod == "2" || info.PrizeResultMethod == "3"
+}
+
+// 解析活动的开奖时间
+func parseOpenTime(info EventInformation) (time.Time, error) {
+	timeLoc, err := time.LoadLocation(config.TimeZone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load timezone error: %v", err)
+	}
+	openTime, err := time.ParseInLocation(openTimeLayout, info.TimeOfWinners, timeLoc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("解析开奖时间失败: %v", err)
+	}
+	return openTime, nil
+}
+
+// 开奖所需的最少参与人数，未设置时与奖品数量相同
+func minParticipants(info EventInformation) int {
+	if info.MinParticipants > 0 {
+		return info.MinParticipants
+	}
+	return max(info.PrizeCount, 1)
+}
+
+// 参与人数不足时的处理方式，旧版本的活动为取消
+func minAction(info EventInformation) string {
+	if info.MinAction == "" {
+		return minActionCancel
+	}
+	return info.MinAction
+}
+
+// 将开奖时间延长 ExtendHours 小时，开奖时间已过（例如停机期间到期）时从当前时间开始延长
+func extendOpenTime(info EventInformation) (string, error) {
+	openTime, err := parseOpenTime(info)
+	if err != nil {
+		return "", err
+	}
+	if now := time.Now(); openTime.Before(now) {
+		openTime = now.In(openTime.Location())
+	}
+	hours := info.ExtendHours
+	if hours <= 0 {
+		hours = defaultExtendHours
+	}
+	return openTime.Add(time.Duration(hours) * time.Hour).Format(openTimeLayout), nil
+}
+
+// 解析 /create 中按时间或人数开奖的条件，格式为 时间,人数
+func parseHybridTrigger(spec string) (openTime string, count int, err error) {
+	openTime, countStr, ok := strings.Cut(spec, ",")
+	if !ok {
+		return "", 0, fmt.Errorf("按时间或人数开奖的条件格式为 时间,人数，例如 20240823-23:07,30")
+	}
+	count, err = strconv.Atoi(countStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("请传递一个整数--开奖人数")
+	}
+	return openTime, count, nil
+}
+
+// 解析人数不足时的处理方式，格式为 cancel、extend[:小时] 或 draw
+func parseMinAction(spec string) (action string, hours int, err error) {
+	action, hoursStr, hasHours := strings.Cut(spec, ":")
+	switch action {
+	case minActionCancel, minActionDraw:
+		if hasHours {
+			return "", 0, fmt.Errorf("只有 extend 可以设置延长的小时数")
+		}
+		return action, 0, nil
+	case minActionExtend:
+		if !hasHours {
+			return action, defaultExtendHours, nil
+		}
+		hours, err = strconv.Atoi(hoursStr)
+		if err != nil || hours < 1 {
+			return "", 0, fmt.Errorf("延长的小时数必须是正整数: %s", hoursStr)
+		}
+		return action, hours, nil
+	}
+	return "", 0, fmt.Errorf("不支持的人数不足处理方式: %s，可选 cancel、extend[:小时]、draw", spec)
+}
+
+// 检查最少参与人数规则与开奖方式是否冲突
+func checkMinParticipantsRule(info EventInformation) error {
+	if info.MinAction == minActionExtend && !drawsAtTime(info) {
+		return fmt.Errorf("延长开奖时间只适用于按时间开奖的活动")
+	}
+	if drawsAtCount(info) && minParticipants(info) > info.NumberOfWinners {
+		return fmt.Errorf("最少参与人数不能大于开奖人数 %d", info.NumberOfWinners)
+	}
+	return nil
+}
+
+// 人数不足时处理方式的说明
+func minActionText(info EventInformation) string {
+	switch minAction(info) {
+	case minActionExtend:
+		hours := info.ExtendHours
+		if hours <= 0 {
+			hours = defaultExtendHours
+		}
+		return fmt.Sprintf("延长开奖时间 %d 小时", hours)
+	case minActionDraw:
+		return "照常开奖，奖品多于参与人数时全员中奖，剩余奖品退回库存"
+	}
+	return "取消活动"
+}
+
+// 生成最少参与人数规则的说明，未设置规则的活动不显示
+func formatMinParticipantsHTML(info EventInformation) string {
+	if info.MinParticipants == 0 && info.MinAction == "" {
+		return ""
+	}
+	return fmt.Sprintf("<b>最少参与人数：</b> %d，不足时%s\n", minParticipants(info), minActionText(info))
+}
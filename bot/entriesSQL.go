@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+)
+
+// 记录每位参与者开奖时的抽奖次数，供事后复算
+func (s *sqliteStore) SaveEntries(eventID string, partners []Partner) error {
+	for _, partner := range partners {
+		_, err := s.db.Exec("UPDATE participants SET entries = ? WHERE event_id = ? AND user_id = ?",
+			entryWeight(partner), eventID, partner.UserID)
+		if err != nil {
+			return fmt.Errorf("SaveEntries ERROR: %v", err)
+		}
+	}
+	return nil
+}
+
+// 用户在活动的抽奖群中发送的消息数量加一
+func (s *sqliteStore) IncrementMessageCount(eventID string, userID int64) error {
+	_, err := s.db.Exec(`
+	INSERT INTO event_messages (event_id, user_id, count) VALUES (?, ?, 1)
+	ON CONFLICT (event_id, user_id) DO UPDATE SET count = count + 1
+	`, eventID, userID)
+	if err != nil {
+		return fmt.Errorf("IncrementMessageCount ERROR: %v", err)
+	}
+	return nil
+}
+
+// 查询活动期间每位用户在抽奖群中发送的消息数量
+func (s *sqliteStore) ListMessageCounts(eventID string) (map[int64]int, error) {
+	return s.queryUserCounts("SELECT user_id, count FROM event_messages WHERE event_id = ?", eventID)
+}
+
+// 用导入的基础抽奖次数替换活动原有的设置
+func (s *sqliteStore) ReplaceEntryWeights(eventID string, weights map[int64]int) error {
+	return s.withTx(func(tx *sqliteStore) error {
+		_, err := tx.db.Exec("DELETE FROM entry_weights WHERE event_id = ?", eventID)
+		if err != nil {
+			return fmt.Errorf("ReplaceEntryWeights ERROR: %v", err)
+		}
+		for userID, weight := range weights {
+			_, err = tx.db.Exec("INSERT INTO entry_weights (event_id, user_id, weight) VALUES (?, ?, ?)", eventID, userID, weight)
+			if err != nil {
+				return fmt.Errorf("ReplaceEntryWeights ERROR: %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+// 查询活动导入的基础抽奖次数
+func (s *sqliteStore) ListEntryWeights(eventID string) (map[int64]int, error) {
+	return s.queryUserCounts("SELECT user_id, weight FROM entry_weights WHERE event_id = ?", eventID)
+}
+
+// 查询 用户ID -> 数量 的映射，query 须返回 user_id 和一个整数列
+func (s *sqliteStore) queryUserCounts(query string, args ...any) (map[int64]int, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("queryUserCounts ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close err: %v", err)
+		}
+	}()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var userID int64
+		var count int
+		if err = rows.Scan(&userID, &count); err != nil {
+			return nil, fmt.Errorf("queryUserCounts ERROR: %v", err)
+		}
+		counts[userID] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("queryUserCounts ERROR: %v", err)
+	}
+	return counts, nil
+}
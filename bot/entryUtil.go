@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// 计算抽奖次数所需的数据，开奖和 /see 共用
+type entrySources struct {
+	weights  map[int64]int  // 导入的基础抽奖次数
+	messages map[int64]int  // 活动期间在抽奖群中发送的消息数量
+	vips     map[int64]bool // 抽奖群管理员和 VIP 名单
+}
+
+// 活动是否设置了加权抽奖的规则，导入的基础抽奖次数不在此列
+func hasEntryRules(info EventInformation) bool {
+	return info.ReferralCap > 0 || info.MessagesPerEntry > 0 || info.VIPMultiplier > 1
+}
+
+// 发送消息获得的额外抽奖次数：每 MessagesPerEntry 条消息增加一次，设置了上限时最多增加 MessageEntriesCap 次
+func messageBonus(info EventInformation, count int) int {
+	if info.MessagesPerEntry <= 0 {
+		return 0
+	}
+	bonus := count / info.MessagesPerEntry
+	if info.MessageEntriesCap > 0 {
+		bonus = min(bonus, info.MessageEntriesCap)
+	}
+	return bonus
+}
+
+// 解析活跃奖励的设置，格式为 消息数[:次数上限]
+func parseMessageEntries(spec string) (perEntry int, limit int, err error) {
+	perEntryStr, capStr, hasCap := strings.Cut(spec, ":")
+	perEntry, err = strconv.Atoi(perEntryStr)
+	if err != nil || perEntry < 1 {
+		return 0, 0, fmt.Errorf("每次抽奖机会所需的消息数必须是正整数: %s", perEntryStr)
+	}
+	if hasCap {
+		limit, err = strconv.Atoi(capStr)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("活跃奖励的次数上限必须是正整数: %s", capStr)
+		}
+	}
+	return perEntry, limit, nil
+}
+
+// 参与者的抽奖次数 = 基础抽奖次数（默认 1，可通过 CSV 导入）+ 邀请奖励 + 消息奖励，
+// 抽奖群管理员和 VIP 名单中的用户再乘以 VIP 倍数
+func computeEntries(info EventInformation, partner Partner, src entrySources) int {
+	entries := 1
+	if weight, ok := src.weights[partner.UserID]; ok {
+		entries = weight
+	}
+	entries += referralBonus(info, partner.Referrals) + messageBonus(info, src.messages[partner.UserID])
+	if info.VIPMultiplier > 1 && src.vips[partner.UserID] {
+		entries *= info.VIPMultiplier
+	}
+	return entries
+}
+
+// 按活动的规则计算每位参与者的抽奖次数
+func applyEntries(info EventInformation, partners []Partner, src entrySources) []Partner {
+	for i := range partners {
+		partners[i].Entries = computeEntries(info, partners[i], src)
+	}
+	return partners
+}
+
+// 是否记录了开奖时的抽奖次数，旧版本开奖的活动没有记录
+func hasStoredEntries(partners []Partner) bool {
+	for _, partner := range partners {
+		if partner.Entries > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 从数据库读取导入的基础抽奖次数和消息数量，vips 需要调用 Telegram 接口，由调用方传入
+func loadEntrySources(store ParticipantStore, info EventInformation, vips map[int64]bool) (src entrySources, err error) {
+	src.vips = vips
+	src.weights, err = store.ListEntryWeights(info.ID)
+	if err != nil {
+		return entrySources{}, err
+	}
+	if info.MessagesPerEntry > 0 {
+		src.messages, err = store.ListMessageCounts(info.ID)
+		if err != nil {
+			return entrySources{}, err
+		}
+	}
+	return src, nil
+}
+
+// 配置的 VIP 名单
+func configVIPs() map[int64]bool {
+	vips := make(map[int64]bool)
+	for _, userID := range config.VIPUserIDs {
+		vips[userID] = true
+	}
+	return vips
+}
+
+// 活动的 VIP：配置的 VIP 名单和活动所属抽奖群的管理员，未设置 VIP 倍数的活动返回 nil
+// 无法获取群管理员时返回配置的 VIP 名单和错误
+func (b *Bot) loadVIPs(info EventInformation) (map[int64]bool, error) {
+	if info.VIPMultiplier <= 1 {
+		return nil, nil
+	}
+	vips := configVIPs()
+	admins, err := b.Bot.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: b.eventChatID(info)},
+	})
+	if err != nil {
+		return vips, fmt.Errorf("GetChatAdministrators failed: %w", err)
+	}
+	for _, admin := range admins {
+		if admin.User != nil && !admin.User.IsBot {
+			vips[admin.User.ID] = true
+		}
+	}
+	return vips, nil
+}
+
+// 用户在活动中的抽奖次数，已开奖的活动为开奖时记录的次数，未开奖时按当前的数据估算
+func (b *Bot) userEntries(info EventInformation, userID int64, p Participation) (int, error) {
+	if p.Entries > 0 {
+		return p.Entries, nil
+	}
+	var vips map[int64]bool
+	if info.VIPMultiplier > 1 {
+		vips = configVIPs()
+		if b.isGroupAdmin(userID, b.eventChatID(info)) {
+			vips[userID] = true
+		}
+	}
+	src, err := loadEntrySources(b.store, info, vips)
+	if err != nil {
+		return 0, err
+	}
+	return computeEntries(info, Partner{UserID: userID, Referrals: p.Referrals}, src), nil
+}
+
+// 生成加权抽奖规则的说明，未设置规则的活动不显示
+func formatEntryRulesHTML(info EventInformation) string {
+	text := formatReferralRuleHTML(info)
+	if info.MessagesPerEntry > 0 {
+		text += fmt.Sprintf("<b>活跃奖励：</b> 活动期间在抽奖群中每发送 %d 条消息增加一次抽奖机会", info.MessagesPerEntry)
+		if info.MessageEntriesCap > 0 {
+			text += fmt.Sprintf("，最多增加 %d 次", info.MessageEntriesCap)
+		}
+		text += "\n"
+	}
+	if info.VIPMultiplier > 1 {
+		text += fmt.Sprintf("<b>VIP 奖励：</b> 抽奖群管理员和 VIP 的抽奖次数 ×%d\n", info.VIPMultiplier)
+	}
+	return text
+}
+
+// 统计用户在进行中的活动的抽奖群中发送的消息数量，只统计设置了活跃奖励的活动
+func (b *Bot) countGroupMessage(msg *tgbotapi.Message) {
+	if msg.From == nil || msg.From.IsBot {
+		return
+	}
+	// 旧版本创建的活动没有记录群组，属于第一个抽奖群
+	chatIDs := []int64{msg.Chat.ID}
+	if len(b.groups) > 0 && b.groups[0].ID == msg.Chat.ID {
+		chatIDs = append(chatIDs, 0)
+	}
+	eventIDs, err := b.store.ListMessageCountingEvents(chatIDs...)
+	if err != nil {
+		log.Printf("ListMessageCountingEvents failed: %v", err)
+		return
+	}
+	for _, eventID := range eventIDs {
+		err = b.store.IncrementMessageCount(eventID, msg.From.ID)
+		if err != nil {
+			log.Printf("IncrementMessageCount: %v", err)
+		}
+	}
+}
@@ -7,10 +7,42 @@ import (
 	"fmt"
 	"log"
 	"sort"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
 )
 
-// 保存活动信息到数据库
-func saveEventsInformation(db *sql.DB, info EventInformation) error {
+// 活动表的查询列，顺序与扫描到 EventInformation 的顺序一致
+const eventColumns = `id, group_name, prize_name, prize_result_method, prize_result, how_to_participate,
+	participate, key_word, prizes_list, time_of_winners, all_prizes, choose_prizes,
+	prize_count, number_of_winners, open_status, cancel_status, seed, seed_commitment, tiers, chat_id, announce_message_id, required_chats,
+	min_participants, min_participants_action, extend_hours, claim_hours, alternate_count, referral_cap,
+	messages_per_entry, message_entries_cap, vip_multiplier, cooldown_days, cooldown_events, monthly_win_cap`
+
+// 更新已有活动时覆盖除ID外的所有列
+const eventUpsertClause = `
+	ON CONFLICT(id) DO UPDATE SET
+		group_name=excluded.group_name, prize_name=excluded.prize_name, prize_result_method=excluded.prize_result_method,
+		prize_result=excluded.prize_result, how_to_participate=excluded.how_to_participate, participate=excluded.participate,
+		key_word=excluded.key_word, prizes_list=excluded.prizes_list, time_of_winners=excluded.time_of_winners,
+		all_prizes=excluded.all_prizes, choose_prizes=excluded.choose_prizes, prize_count=excluded.prize_count,
+		number_of_winners=excluded.number_of_winners, open_status=excluded.open_status, cancel_status=excluded.cancel_status,
+		seed=excluded.seed, seed_commitment=excluded.seed_commitment, tiers=excluded.tiers, chat_id=excluded.chat_id,
+		announce_message_id=excluded.announce_message_id, required_chats=excluded.required_chats,
+		min_participants=excluded.min_participants, min_participants_action=excluded.min_participants_action,
+		extend_hours=excluded.extend_hours, claim_hours=excluded.claim_hours, alternate_count=excluded.alternate_count,
+		referral_cap=excluded.referral_cap, messages_per_entry=excluded.messages_per_entry,
+		message_entries_cap=excluded.message_entries_cap, vip_multiplier=excluded.vip_multiplier,
+		cooldown_days=excluded.cooldown_days, cooldown_events=excluded.cooldown_events, monthly_win_cap=excluded.monthly_win_cap
+	`
+
+// 保存活动信息到数据库，活动已存在时更新
+func (s *sqliteStore) SaveEvent(info EventInformation) error {
+	return s.insertEvent(info, eventUpsertClause)
+}
+
+// 插入活动信息，onConflict 为空时活动ID已存在会返回主键冲突的错误
+func (s *sqliteStore) insertEvent(info EventInformation, onConflict string) error {
 	// 序列化奖品列表和选择的奖品为JSON字符串
 	allPrizesJSON, err := json.Marshal(info.AllPrizes)
 	if err != nil {
@@ -22,19 +54,26 @@ func saveEventsInformation(db *sql.DB, info EventInformation) error {
 		return fmt.Errorf("error marshalling choose prizes: %v", err)
 	}
 
-	stmt, err := db.Prepare(`
+	tiersJSON, err := json.Marshal(info.Tiers)
+	if err != nil {
+		return fmt.Errorf("error marshalling tiers: %v", err)
+	}
+
+	requiredChatsJSON, err := json.Marshal(info.RequiredChats)
+	if err != nil {
+		return fmt.Errorf("error marshalling required chats: %v", err)
+	}
+
+	stmt, err := s.db.Prepare(`
 	INSERT INTO events (
 		id, group_name, prize_name, prize_result_method, prize_result, how_to_participate,
 		participate, key_word, prizes_list, time_of_winners, all_prizes, choose_prizes,
-		prize_count, number_of_winners, open_status, cancel_status
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(id) DO UPDATE SET
-		group_name=excluded.group_name, prize_name=excluded.prize_name, prize_result_method=excluded.prize_result_method,
-		prize_result=excluded.prize_result, how_to_participate=excluded.how_to_participate, participate=excluded.participate,
-		key_word=excluded.key_word, prizes_list=excluded.prizes_list, time_of_winners=excluded.time_of_winners,
-		all_prizes=excluded.all_prizes, choose_prizes=excluded.choose_prizes, prize_count=excluded.prize_count,
-		number_of_winners=excluded.number_of_winners, open_status=excluded.open_status, cancel_status=excluded.cancel_status
-	`)
+		prize_count, number_of_winners, open_status, cancel_status, seed, seed_commitment, tiers, chat_id,
+		announce_message_id, required_chats, min_participants, min_participants_action, extend_hours,
+		claim_hours, alternate_count, referral_cap, messages_per_entry, message_entries_cap, vip_multiplier,
+		cooldown_days, cooldown_events, monthly_win_cap
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	` + onConflict)
 	if err != nil {
 		return fmt.Errorf("error saving create information: %v", err)
 	}
@@ -48,64 +87,113 @@ func saveEventsInformation(db *sql.DB, info EventInformation) error {
 		info.ID, info.GroupName, info.PrizeName, info.PrizeResultMethod, info.PrizeResult,
 		info.HowToParticipate, info.Participate, info.KeyWord, info.PrizesList, info.TimeOfWinners,
 		string(allPrizesJSON), string(choosePrizesJSON), info.PrizeCount, info.NumberOfWinners,
-		info.OpenStatus, info.CancelStatus,
+		info.OpenStatus, info.CancelStatus, info.Seed, info.SeedCommitment, string(tiersJSON), info.ChatID,
+		info.AnnounceMessageID, string(requiredChatsJSON), info.MinParticipants, info.MinAction, info.ExtendHours,
+		info.ClaimHours, info.AlternateCount, info.ReferralCap,
+		info.MessagesPerEntry, info.MessageEntriesCap, info.VIPMultiplier,
+		info.CooldownDays, info.CooldownEvents, info.MonthlyWinCap,
 	)
 	if err != nil {
-		return fmt.Errorf("error saving create information: %v", err)
+		return fmt.Errorf("error saving create information: %w", err)
 	}
 
 	return nil
 }
 
-// 加载所有活动信息
-func loadAllEvents(db *sql.DB) (AllEvent []EventInformation, err error) {
-	rows, err := db.Query("SELECT * FROM events")
-	if err != nil {
-		return nil, fmt.Errorf("loadCreateInformation ERROR: %v", err)
-	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("rows.Close ERROR: %v", err)
+// 保存新建的活动并从库存中预留其选中的奖品，活动ID已存在时返回 errEventIDExists，不覆盖已有的活动
+func (s *sqliteStore) CreateEvent(info EventInformation) error {
+	return s.withTx(func(tx *sqliteStore) error {
+		err := tx.insertEvent(info, "")
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("活动ID %s: %w", info.ID, errEventIDExists)
 		}
-	}()
-
-	for rows.Next() {
-		var info EventInformation
-		var allPrizesJSON, choosePrizesJSON string
-
-		err = rows.Scan(
-			&info.ID, &info.GroupName, &info.PrizeName, &info.PrizeResultMethod, &info.PrizeResult,
-			&info.HowToParticipate, &info.Participate, &info.KeyWord, &info.PrizesList,
-			&info.TimeOfWinners, &allPrizesJSON, &choosePrizesJSON,
-			&info.PrizeCount, &info.NumberOfWinners, &info.OpenStatus, &info.CancelStatus,
-		)
 		if err != nil {
-			return nil, fmt.Errorf("scan events ERROR: %v", err)
+			return err
 		}
+		return tx.ReservePrizes(info.ID, eventTiers(info))
+	})
+}
 
-		// 反序列化奖品列表和选择的奖品
-		if err = json.Unmarshal([]byte(allPrizesJSON), &info.AllPrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal allPrizes ERROR: %v", err)
-		}
-		if err = json.Unmarshal([]byte(choosePrizesJSON), &info.ChoosePrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal choosePrizes ERROR: %v", err)
-		}
+// 将活动标记为已开奖，仅当活动仍处于未开奖且未取消状态时生效
+func (s *sqliteStore) MarkEventOpened(id string) (bool, error) {
+	result, err := s.db.Exec("UPDATE events SET open_status = 1, opened_at = CURRENT_TIMESTAMP WHERE id = ? AND open_status = 0 AND cancel_status = 0", id)
+	if err != nil {
+		return false, fmt.Errorf("MarkEventOpened ERROR: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("MarkEventOpened ERROR: %v", err)
+	}
+	return affected == 1, nil
+}
 
-		AllEvent = append(AllEvent, info)
+// 将活动标记为已取消，仅当活动仍处于未开奖且未取消状态时生效
+func (s *sqliteStore) MarkEventCanceled(id string) (bool, error) {
+	result, err := s.db.Exec("UPDATE events SET cancel_status = 1 WHERE id = ? AND open_status = 0 AND cancel_status = 0", id)
+	if err != nil {
+		return false, fmt.Errorf("MarkEventCanceled ERROR: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("MarkEventCanceled ERROR: %v", err)
 	}
+	return affected == 1, nil
+}
 
-	sort.Slice(AllEvent, func(i, j int) bool {
-		return AllEvent[i].ID < AllEvent[j].ID
-	})
+// 记录活动公告消息的ID，用于之后更新公告
+func (s *sqliteStore) SetAnnounceMessageID(id string, messageID int) error {
+	_, err := s.db.Exec("UPDATE events SET announce_message_id = ? WHERE id = ?", messageID, id)
+	if err != nil {
+		return fmt.Errorf("SetAnnounceMessageID ERROR: %v", err)
+	}
+	return nil
+}
 
-	return AllEvent, nil
+// rowScanner 由 *sql.Row 和 *sql.Rows 共同实现
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// 加载未开奖和未取消的所有活动信息
-func loadNoCancelAndNoOpenEvents(db *sql.DB) (onEvent []EventInformation, err error) {
-	rows, err := db.Query("SELECT * FROM events WHERE open_status = 0 AND cancel_status = 0")
+// 按 eventColumns 的顺序扫描一行活动信息，并反序列化其中的JSON字段
+func scanEvent(row rowScanner) (info EventInformation, err error) {
+	var allPrizesJSON, choosePrizesJSON, tiersJSON, requiredChatsJSON string
+
+	err = row.Scan(
+		&info.ID, &info.GroupName, &info.PrizeName, &info.PrizeResultMethod, &info.PrizeResult,
+		&info.HowToParticipate, &info.Participate, &info.KeyWord, &info.PrizesList,
+		&info.TimeOfWinners, &allPrizesJSON, &choosePrizesJSON,
+		&info.PrizeCount, &info.NumberOfWinners, &info.OpenStatus, &info.CancelStatus,
+		&info.Seed, &info.SeedCommitment, &tiersJSON, &info.ChatID, &info.AnnounceMessageID, &requiredChatsJSON,
+		&info.MinParticipants, &info.MinAction, &info.ExtendHours, &info.ClaimHours, &info.AlternateCount,
+		&info.ReferralCap, &info.MessagesPerEntry, &info.MessageEntriesCap, &info.VIPMultiplier,
+		&info.CooldownDays, &info.CooldownEvents, &info.MonthlyWinCap,
+	)
+	if err != nil {
+		return EventInformation{}, err
+	}
+
+	// 反序列化奖品列表和选择的奖品
+	if err = json.Unmarshal([]byte(allPrizesJSON), &info.AllPrizes); err != nil {
+		return EventInformation{}, fmt.Errorf("json unmarshal allPrizes ERROR: %v", err)
+	}
+	if err = json.Unmarshal([]byte(choosePrizesJSON), &info.ChoosePrizes); err != nil {
+		return EventInformation{}, fmt.Errorf("json unmarshal choosePrizes ERROR: %v", err)
+	}
+	if err = json.Unmarshal([]byte(tiersJSON), &info.Tiers); err != nil {
+		return EventInformation{}, fmt.Errorf("json unmarshal tiers ERROR: %v", err)
+	}
+	if err = json.Unmarshal([]byte(requiredChatsJSON), &info.RequiredChats); err != nil {
+		return EventInformation{}, fmt.Errorf("json unmarshal required chats ERROR: %v", err)
+	}
+	return info, nil
+}
+
+// 查询活动列表，query 须按 eventColumns 的顺序返回列，结果按活动ID排序
+func (s *sqliteStore) queryEvents(query string, args ...any) (events []EventInformation, err error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("loadCreateInformation ERROR: %v", err)
+		return nil, fmt.Errorf("queryEvents ERROR: %v", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -114,115 +202,85 @@ func loadNoCancelAndNoOpenEvents(db *sql.DB) (onEvent []EventInformation, err er
 	}()
 
 	for rows.Next() {
-		var info EventInformation
-		var allPrizesJSON, choosePrizesJSON string
-
-		err = rows.Scan(
-			&info.ID, &info.GroupName, &info.PrizeName, &info.PrizeResultMethod, &info.PrizeResult,
-			&info.HowToParticipate, &info.Participate, &info.KeyWord, &info.PrizesList,
-			&info.TimeOfWinners, &allPrizesJSON, &choosePrizesJSON,
-			&info.PrizeCount, &info.NumberOfWinners, &info.OpenStatus, &info.CancelStatus,
-		)
+		info, err := scanEvent(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scan events ERROR: %v", err)
 		}
-
-		// 反序列化奖品列表和选择的奖品
-		if err = json.Unmarshal([]byte(allPrizesJSON), &info.AllPrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal allPrizes ERROR: %v", err)
-		}
-		if err = json.Unmarshal([]byte(choosePrizesJSON), &info.ChoosePrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal choosePrizes ERROR: %v", err)
-		}
-
-		onEvent = append(onEvent, info)
+		events = append(events, info)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("queryEvents ERROR: %v", err)
 	}
 
-	sort.Slice(onEvent, func(i, j int) bool {
-		return onEvent[i].ID < onEvent[j].ID
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
 	})
+	return events, nil
+}
 
-	return onEvent, nil
+// 加载所有活动信息
+func (s *sqliteStore) ListEvents() ([]EventInformation, error) {
+	return s.queryEvents("SELECT " + eventColumns + " FROM events")
 }
 
-// 加载已取消的所有活动信息
-func loadCancelEvents(db *sql.DB) (cancelEvent []EventInformation, err error) {
-	rows, err := db.Query("SELECT * FROM events WHERE open_status = 0 AND cancel_status = 1")
+// 加载未开奖和未取消的所有活动信息
+func (s *sqliteStore) ListOngoingEvents() ([]EventInformation, error) {
+	return s.queryEvents("SELECT " + eventColumns + " FROM events WHERE open_status = 0 AND cancel_status = 0")
+}
+
+// 查找属于指定群组、未开奖未取消且按发言数量增加抽奖次数的活动ID，每条群消息都会查询，只读取活动ID
+func (s *sqliteStore) ListMessageCountingEvents(chatIDs ...int64) ([]string, error) {
+	if len(chatIDs) == 0 {
+		return nil, nil
+	}
+	placeholders := strings.Repeat(", ?", len(chatIDs))[2:]
+	args := make([]any, len(chatIDs))
+	for i, chatID := range chatIDs {
+		args[i] = chatID
+	}
+	rows, err := s.db.Query("SELECT id FROM events WHERE chat_id IN ("+placeholders+
+		") AND open_status = 0 AND cancel_status = 0 AND messages_per_entry > 0", args...)
 	if err != nil {
-		return nil, fmt.Errorf("loadCreateInformation ERROR: %v", err)
+		return nil, fmt.Errorf("ListMessageCountingEvents ERROR: %v", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
-			log.Printf("rows.Close ERROR: %v", err)
+			log.Printf("rows.Close err: %v", err)
 		}
 	}()
 
+	var ids []string
 	for rows.Next() {
-		var info EventInformation
-		var allPrizesJSON, choosePrizesJSON string
-
-		err = rows.Scan(
-			&info.ID, &info.GroupName, &info.PrizeName, &info.PrizeResultMethod, &info.PrizeResult,
-			&info.HowToParticipate, &info.Participate, &info.KeyWord, &info.PrizesList,
-			&info.TimeOfWinners, &allPrizesJSON, &choosePrizesJSON,
-			&info.PrizeCount, &info.NumberOfWinners, &info.OpenStatus, &info.CancelStatus,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("scan events ERROR: %v", err)
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ListMessageCountingEvents ERROR: %v", err)
 		}
-
-		// 反序列化奖品列表和选择的奖品
-		if err = json.Unmarshal([]byte(allPrizesJSON), &info.AllPrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal allPrizes ERROR: %v", err)
-		}
-		if err = json.Unmarshal([]byte(choosePrizesJSON), &info.ChoosePrizes); err != nil {
-			return nil, fmt.Errorf("json unmarshal choosePrizes ERROR: %v", err)
-		}
-
-		cancelEvent = append(cancelEvent, info)
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListMessageCountingEvents ERROR: %v", err)
 	}
+	return ids, nil
+}
 
-	sort.Slice(cancelEvent, func(i, j int) bool {
-		return cancelEvent[i].ID < cancelEvent[j].ID
-	})
+// 加载已取消的所有活动信息
+func (s *sqliteStore) ListCanceledEvents() ([]EventInformation, error) {
+	return s.queryEvents("SELECT " + eventColumns + " FROM events WHERE open_status = 0 AND cancel_status = 1")
+}
 
-	return cancelEvent, nil
+// 通过用户ID获取此用户参与过的所有活动信息
+func (s *sqliteStore) ListEventsByParticipant(userID int64) ([]EventInformation, error) {
+	return s.queryEvents("SELECT "+eventColumns+" FROM events WHERE id IN (SELECT event_id FROM participants WHERE user_id = ?)", userID)
 }
 
 // 检查特定活动 ID 的数据
-func checkEventInformationFromId(db *sql.DB, id string) (info EventInformation, err error) {
-	var allPrizesJSON, choosePrizesJSON string
-
-	stmt, err := db.Prepare("SELECT * FROM events WHERE id = ?")
-	if err != nil {
-		return EventInformation{}, fmt.Errorf("checkCreateInformation ERROR: %v", err)
-	}
-	defer func() {
-		if err := stmt.Close(); err != nil {
-			log.Printf("stmt.Close ERROR: %v", err)
-		}
-	}()
-
-	err = stmt.QueryRow(id).Scan(
-		&info.ID, &info.GroupName, &info.PrizeName, &info.PrizeResultMethod, &info.PrizeResult,
-		&info.HowToParticipate, &info.Participate, &info.KeyWord, &info.PrizesList,
-		&info.TimeOfWinners, &allPrizesJSON, &choosePrizesJSON,
-		&info.PrizeCount, &info.NumberOfWinners, &info.OpenStatus, &info.CancelStatus,
-	)
+func (s *sqliteStore) GetEvent(id string) (EventInformation, error) {
+	info, err := scanEvent(s.db.QueryRow("SELECT "+eventColumns+" FROM events WHERE id = ?", id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return EventInformation{}, fmt.Errorf("event id does not exist")
 		}
-		return EventInformation{}, fmt.Errorf("checkCreateInformation ERROR: %v", err)
+		return EventInformation{}, fmt.Errorf("GetEvent ERROR: %v", err)
 	}
-
-	// 反序列化奖品列表和选择的奖品
-	if err = json.Unmarshal([]byte(allPrizesJSON), &info.AllPrizes); err != nil {
-		return EventInformation{}, fmt.Errorf("json Unmarshal allPrize err: %v", err)
-	}
-	if err = json.Unmarshal([]byte(choosePrizesJSON), &info.ChoosePrizes); err != nil {
-		return EventInformation{}, fmt.Errorf("json Unmarshal choosePrize err: %v", err)
-	}
-
 	return info, nil
 }
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// 在临时目录中打开执行过迁移的数据库
+func newTestStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "info.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err = migrateUp(db); err != nil {
+		t.Fatalf("migrateUp: %v", err)
+	}
+	return newSQLiteStore(db)
+}
+
+func TestCreateEventRejectsDuplicateID(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.AddPrizes("", []string{"A", "A"}); err != nil {
+		t.Fatalf("AddPrizes: %v", err)
+	}
+
+	first := EventInformation{ID: "20260101120000", PrizeName: "first", PrizeCount: 1, ChoosePrizes: []string{"A"}}
+	if err := store.CreateEvent(first); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	second := first
+	second.PrizeName = "second"
+	if err := store.CreateEvent(second); !errors.Is(err, errEventIDExists) {
+		t.Fatalf("CreateEvent with duplicate ID err = %v, want errEventIDExists", err)
+	}
+
+	info, err := store.GetEvent(first.ID)
+	if err != nil {
+		t.Fatalf("GetEvent: %v", err)
+	}
+	if info.PrizeName != "first" {
+		t.Errorf("PrizeName = %q, want first", info.PrizeName)
+	}
+	// 失败的创建不会再次预留奖品
+	prizes, err := store.ListAvailablePrizes()
+	if err != nil {
+		t.Fatalf("ListAvailablePrizes: %v", err)
+	}
+	if len(prizes) != 1 {
+		t.Errorf("available prizes = %d, want 1", len(prizes))
+	}
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// 生成新的开奖种子及其承诺
+func newSeed() (seed string, commitment string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("generate seed error: %v", err)
+	}
+	seed = hex.EncodeToString(buf)
+	return seed, seedCommitment(seed), nil
+}
+
+// 种子承诺为种子字符串的 SHA256 十六进制值
+func seedCommitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// fairRand 由公开的种子派生的确定性随机数序列，
+// 第 n 个数为 SHA256("种子:n") 前 8 个字节按大端序解析的无符号整数（n 从 0 开始）
+type fairRand struct {
+	seed    string
+	counter uint64
+}
+
+func newFairRand(seed string) *fairRand {
+	return &fairRand{seed: seed}
+}
+
+func (r *fairRand) next() uint64 {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", r.seed, r.counter)))
+	r.counter++
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// 返回 [0, n) 内均匀分布的整数，超出 n 的整数倍范围的值会被丢弃重取，避免取模偏差
+func (r *fairRand) intn(n int) int {
+	un := uint64(n)
+	rem := (math.MaxUint64%un + 1) % un
+	for {
+		v := r.next()
+		if rem == 0 || v < math.MaxUint64-rem+1 {
+			return int(v % un)
+		}
+	}
+}
+
+// 按参与顺序排列的参与者列表做 Fisher-Yates 洗牌，
+// 从最后一位开始，第 i 位与 intn(i+1) 位交换
+func fairShuffle(seed string, partners []Partner) []Partner {
+	shuffled := make([]Partner, len(partners))
+	copy(shuffled, partners)
+
+	r := newFairRand(seed)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := r.intn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
+
+// 参与者的抽奖次数，未设置时为 1
+func entryWeight(partner Partner) int {
+	return max(partner.Entries, 1)
+}
+
+// 是否有参与者的抽奖次数多于 1 次，此时按抽奖次数加权抽取
+func hasWeightedEntries(partners []Partner) bool {
+	for _, partner := range partners {
+		if entryWeight(partner) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// 按抽奖次数加权的不放回抽样，依次抽出前 n 位：
+// 每次取 r = intn(剩余参与者的抽奖次数之和)，按参与顺序累加抽奖次数，第一个累计值大于 r 的参与者被抽出并移出列表
+func weightedOrder(seed string, partners []Partner, n int) []Partner {
+	remaining := make([]Partner, len(partners))
+	copy(remaining, partners)
+	total := 0
+	for _, partner := range remaining {
+		total += entryWeight(partner)
+	}
+
+	r := newFairRand(seed)
+	ordered := make([]Partner, 0, min(n, len(remaining)))
+	for len(ordered) < n && len(remaining) > 0 {
+		x := r.intn(total)
+		i := 0
+		for ; x >= entryWeight(remaining[i]); i++ {
+			x -= entryWeight(remaining[i])
+		}
+		ordered = append(ordered, remaining[i])
+		total -= entryWeight(remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return ordered
+}
+
+// 抽奖顺序的前 n 位：所有参与者都只有 1 次抽奖机会时为洗牌后的顺序，否则为按抽奖次数加权抽出的顺序
+func drawOrder(seed string, partners []Partner, n int) []Partner {
+	n = max(min(n, len(partners)), 0)
+	if hasWeightedEntries(partners) {
+		return weightedOrder(seed, partners, n)
+	}
+	return fairShuffle(seed, partners)[:n]
+}
+
+// 根据种子从参与者中抽取中奖者，抽奖顺序的前 count 位即为中奖者
+func pickWinners(seed string, partners []Partner, count int) []Partner {
+	return drawOrder(seed, partners, count)
+}
+
+// 根据种子抽取候补，抽奖顺序中紧接在前 winnerCount 位中奖者之后的 count 位即为候补，按顺序递补
+func pickAlternates(seed string, partners []Partner, winnerCount int, count int) []Partner {
+	ordered := drawOrder(seed, partners, winnerCount+count)
+	return ordered[min(winnerCount, len(ordered)):]
+}
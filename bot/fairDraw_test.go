@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+)
+
+// 按顺序生成参与者，entries[i] 为第 i+1 位参与者（用户ID 为 i+1）的抽奖次数
+func testPartners(entries ...int) []Partner {
+	partners := make([]Partner, len(entries))
+	for i, e := range entries {
+		partners[i] = Partner{UserID: int64(i + 1), Entries: e}
+	}
+	return partners
+}
+
+func userIDs(partners []Partner) []int64 {
+	ids := make([]int64, len(partners))
+	for i, partner := range partners {
+		ids[i] = partner.UserID
+	}
+	return ids
+}
+
+// 固定种子下的抽奖顺序，公布的复算方法依赖这些结果，改动算法会导致已开奖活动无法复算
+func TestDrawOrderFixedSeeds(t *testing.T) {
+	tests := []struct {
+		name     string
+		seed     string
+		partners []Partner
+		n        int
+		want     []int64
+	}{
+		{name: "shuffle 5", seed: "seed-a", partners: testPartners(1, 1, 1, 1, 1), n: 5, want: []int64{3, 5, 2, 1, 4}},
+		{name: "shuffle 10", seed: "5f2b1c", partners: testPartners(1, 1, 1, 1, 1, 1, 1, 1, 1, 1), n: 10, want: []int64{9, 6, 1, 4, 7, 5, 2, 8, 10, 3}},
+		{name: "shuffle prefix", seed: "5f2b1c", partners: testPartners(1, 1, 1, 1, 1, 1, 1, 1, 1, 1), n: 3, want: []int64{9, 6, 1}},
+		{name: "unset entries count as 1", seed: "seed-a", partners: testPartners(0, 0, 0, 0, 0), n: 5, want: []int64{3, 5, 2, 1, 4}},
+		{name: "weighted all", seed: "seed-a", partners: testPartners(1, 3, 1, 2, 1), n: 5, want: []int64{3, 4, 2, 1, 5}},
+		{name: "weighted prefix", seed: "5f2b1c", partners: testPartners(5, 1, 1, 1), n: 2, want: []int64{1, 4}},
+		{name: "n larger than partners", seed: "seed-a", partners: testPartners(1, 1, 1, 1, 1), n: 8, want: []int64{3, 5, 2, 1, 4}},
+		{name: "negative n", seed: "seed-a", partners: testPartners(1, 3, 1), n: -1, want: []int64{}},
+		{name: "no partners", seed: "seed-a", partners: nil, n: 3, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userIDs(drawOrder(tt.seed, tt.partners, tt.n))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("drawOrder(%q, n=%d) = %v, want %v", tt.seed, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFairShuffleFixedSeed(t *testing.T) {
+	partners := testPartners(1, 1, 1, 1, 1)
+	got := userIDs(fairShuffle("seed-a", partners))
+	if want := []int64{3, 5, 2, 1, 4}; !slices.Equal(got, want) {
+		t.Errorf("fairShuffle = %v, want %v", got, want)
+	}
+	if !slices.Equal(userIDs(partners), []int64{1, 2, 3, 4, 5}) {
+		t.Error("fairShuffle modified its input")
+	}
+}
+
+func TestWeightedOrderFixedSeed(t *testing.T) {
+	partners := testPartners(1, 3, 1, 2, 1)
+	got := userIDs(weightedOrder("seed-a", partners, len(partners)))
+	if want := []int64{3, 4, 2, 1, 5}; !slices.Equal(got, want) {
+		t.Errorf("weightedOrder = %v, want %v", got, want)
+	}
+	if !slices.Equal(userIDs(partners), []int64{1, 2, 3, 4, 5}) {
+		t.Error("weightedOrder modified its input")
+	}
+}
+
+// 候补紧接在中奖者之后，与一次抽出全部顺序的结果一致
+func TestPickAlternatesFollowWinners(t *testing.T) {
+	for _, partners := range [][]Partner{testPartners(1, 1, 1, 1, 1), testPartners(1, 3, 1, 2, 1)} {
+		order := userIDs(drawOrder("seed-a", partners, len(partners)))
+		winners := userIDs(pickWinners("seed-a", partners, 2))
+		alternates := userIDs(pickAlternates("seed-a", partners, 2, 2))
+		if got := append(winners, alternates...); !slices.Equal(got, order[:4]) {
+			t.Errorf("winners+alternates = %v, want %v", got, order[:4])
+		}
+	}
+}
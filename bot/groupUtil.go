@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// lotteryGroup 配置的抽奖群
+type lotteryGroup struct {
+	Ref   string // 配置中填写的群组用户名或会话ID
+	ID    int64  // 会话ID
+	Title string // 群组名称
+}
+
+// 配置的抽奖群列表，默认群组排在第一位
+func configGroupRefs() []string {
+	var refs []string
+	if config.GroupUserName != "" {
+		refs = append(refs, config.GroupUserName)
+	}
+	for _, ref := range config.Groups {
+		ref = strings.TrimSpace(ref)
+		if ref != "" && ref != config.GroupUserName {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// 群组用户名或会话ID对应的 ChatConfig
+func groupChatConfig(ref string) tgbotapi.ChatConfig {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return tgbotapi.ChatConfig{ChatID: id}
+	}
+	return tgbotapi.ChatConfig{SuperGroupUsername: ref}
+}
+
+// 获取所有配置的抽奖群的会话ID和名称
+func (b *Bot) loadGroups() error {
+	refs := configGroupRefs()
+	if len(refs) == 0 {
+		return fmt.Errorf("请在配置文件中设置 group_user_name 或 groups")
+	}
+
+	b.groups = nil
+	for _, ref := range refs {
+		chat, err := b.Bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: groupChatConfig(ref)})
+		if err != nil {
+			return fmt.Errorf("get chat %s error: %v", ref, err)
+		}
+		b.groups = append(b.groups, lotteryGroup{Ref: ref, ID: chat.ID, Title: chat.Title})
+	}
+	return nil
+}
+
+// 按配置中的群组用户名或会话ID查找抽奖群
+func (b *Bot) findGroup(ref string) (lotteryGroup, bool) {
+	for _, group := range b.groups {
+		if strings.EqualFold(group.Ref, ref) || strconv.FormatInt(group.ID, 10) == ref {
+			return group, true
+		}
+	}
+	return lotteryGroup{}, false
+}
+
+// 活动所属抽奖群的会话ID，旧版本活动属于默认群组
+func (b *Bot) eventChatID(info EventInformation) int64 {
+	if info.ChatID != 0 || len(b.groups) == 0 {
+		return info.ChatID
+	}
+	return b.groups[0].ID
+}
+
+// 将活动绑定到指定的抽奖群
+func setEventGroup(info *EventInformation, group lotteryGroup) {
+	info.ChatID = group.ID
+	info.GroupName = group.Title
+}
+
+// 只保留属于指定抽奖群的活动
+func (b *Bot) filterEventsByGroup(events []EventInformation, chatID int64) []EventInformation {
+	var filtered []EventInformation
+	for _, info := range events {
+		if b.eventChatID(info) == chatID {
+			filtered = append(filtered, info)
+		}
+	}
+	return filtered
+}
+
+// /on、/history 翻页按钮的回调数据，格式为 前缀页码_群组ID，群组ID为0时不筛选群组
+func groupPageData(prefix string, page int, groupID int64) string {
+	return fmt.Sprintf("%s%d_%d", prefix, page, groupID)
+}
+
+// 解析去掉前缀的翻页回调数据，旧版本的按钮没有群组ID，视为不筛选群组
+func parseGroupPageData(data string) (page int, groupID int64, err error) {
+	pageStr, groupStr, found := strings.Cut(data, "_")
+	page, err = strconv.Atoi(pageStr)
+	if err != nil {
+		return 0, 0, err
+	}
+	if found {
+		groupID, err = strconv.ParseInt(groupStr, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return page, groupID, nil
+}
+
+// 解析 /on、/history 的参数，以 @ 或 - 开头的参数为群组，其余为页码
+func (b *Bot) parseGroupAndPage(args string) (group *lotteryGroup, page string, err error) {
+	for _, arg := range strings.Fields(args) {
+		if strings.HasPrefix(arg, "@") || strings.HasPrefix(arg, "-") {
+			found, ok := b.findGroup(arg)
+			if !ok {
+				return nil, "", fmt.Errorf("未配置的群组: %s", arg)
+			}
+			group = &found
+			continue
+		}
+		page = arg
+	}
+	return group, page, nil
+}
+
+// 发送消息到指定会话
+func (b *Bot) sendMsgToChat(chatID int64, text string) error {
+	message := tgbotapi.NewMessage(chatID, text)
+	message.ParseMode = tgbotapi.ModeHTML
+
+	_, err := b.Bot.Send(message)
+	if err != nil {
+		log.Printf("sendMsgToChat err %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// 发送消息到活动所属的抽奖群
+func (b *Bot) sendMsgToEventGroup(info EventInformation, text string) error {
+	chatID := b.eventChatID(info)
+	if chatID == 0 {
+		return fmt.Errorf("活动 %s 没有所属的抽奖群", info.ID)
+	}
+	return b.sendMsgToChat(chatID, text)
+}
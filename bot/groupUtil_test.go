@@ -0,0 +1,28 @@
+package bot
+
+import "testing"
+
+func TestGroupPageData(t *testing.T) {
+	tests := []struct {
+		data        string
+		wantPage    int
+		wantGroupID int64
+		wantErr     bool
+	}{
+		{data: groupPageData("cmdOnPage", 2, -100123)[len("cmdOnPage"):], wantPage: 2, wantGroupID: -100123},
+		{data: groupPageData("cmdOnPage", 3, 0)[len("cmdOnPage"):], wantPage: 3},
+		{data: "4", wantPage: 4}, // 旧版本的按钮没有群组ID
+		{data: "x_1", wantErr: true},
+		{data: "1_x", wantErr: true},
+	}
+	for _, tt := range tests {
+		page, groupID, err := parseGroupPageData(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGroupPageData(%q) err = %v, wantErr %v", tt.data, err, tt.wantErr)
+			continue
+		}
+		if page != tt.wantPage || groupID != tt.wantGroupID {
+			t.Errorf("parseGroupPageData(%q) = %d, %d, want %d, %d", tt.data, page, groupID, tt.wantPage, tt.wantGroupID)
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package bot
 
 import (
-	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"strconv"
+	"strings"
 )
 
 func (b *Bot) handleUpdate(msg *tgbotapi.Message) {
@@ -79,10 +79,60 @@ func (b *Bot) handleUpdate(msg *tgbotapi.Message) {
 		if err != nil {
 			log.Printf("cmdPrize failed: %v", err)
 		}
+	case "verify":
+		err := b.cmdVerify(msg)
+		if err != nil {
+			log.Printf("cmdVerify failed: %v", err)
+		}
+	case "admin":
+		err := b.cmdAdmin(msg)
+		if err != nil {
+			log.Printf("cmdAdmin failed: %v", err)
+		}
+	case "weights":
+		err := b.cmdWeights(msg)
+		if err != nil {
+			log.Printf("cmdWeights failed: %v", err)
+		}
+	case "undelivered":
+		err := b.cmdUndelivered(msg)
+		if err != nil {
+			log.Printf("cmdUndelivered failed: %v", err)
+		}
+	case "ban":
+		err := b.cmdBan(msg)
+		if err != nil {
+			log.Printf("cmdBan failed: %v", err)
+		}
+	case "unban":
+		err := b.cmdUnban(msg)
+		if err != nil {
+			log.Printf("cmdUnban failed: %v", err)
+		}
+	case "banlist":
+		err := b.cmdBanlist(msg)
+		if err != nil {
+			log.Printf("cmdBanlist failed: %v", err)
+		}
+	case "cancel_wizard":
+		err := b.cmdCancelWizard(msg)
+		if err != nil {
+			log.Printf("cmdCancelWizard failed: %v", err)
+		}
 
 	}
 }
 
+// 文件说明中的指令名称，不以 / 开头时返回空字符串
+func captionCommand(msg *tgbotapi.Message) string {
+	fields := strings.Fields(msg.Caption)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	command, _, _ := strings.Cut(fields[0][1:], "@")
+	return command
+}
+
 func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	data := callbackQuery.Data
 	userID := callbackQuery.From.ID
@@ -94,29 +144,59 @@ func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 	case data[:4] == "noop":
 		log.Println("Ignore operation noop")
 
-	case len(data) >= 9 && data[:9] == "cmdOnPage":
-		page, err := strconv.Atoi(data[9:])
+	case strings.HasPrefix(data, "cmdOnPage"):
+		// 翻页时重新读取活动列表，按钮中携带 /on 的群组筛选条件
+		page, groupID, err := parseGroupPageData(strings.TrimPrefix(data, "cmdOnPage"))
 		if err != nil {
 			log.Printf("Invalid page number: %v", err)
 			return
 		}
-		b.sendPageCmdOn(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+		// 发出指令后可能已被移除管理员或不再是群管理员，翻页时重新检查权限
+		if !b.hasPermission(userID, permView, groupID) {
+			log.Printf("user %d has no permission to view ongoing events", userID)
+			return
+		}
+		onEvents, err := b.listOngoingEvents(groupID)
+		if err != nil {
+			log.Printf("listOngoingEvents: %v", err)
+			return
+		}
+		b.sendPageCmdOn(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, onEvents, groupID, page)
 
-	case len(data) >= 13 && data[:13] == "cmdCancelPage":
-		page, err := strconv.Atoi(data[13:])
+	case strings.HasPrefix(data, "cmdCancelPage"):
+		if !b.hasPermission(userID, permView, 0) {
+			log.Printf("user %d has no permission to view canceled events", userID)
+			return
+		}
+		page, err := strconv.Atoi(strings.TrimPrefix(data, "cmdCancelPage"))
 		if err != nil {
 			log.Printf("Invalid page number: %v", err)
 			return
 		}
-		b.sendPageCmdCancel(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+		cancelEvents, err := b.store.ListCanceledEvents()
+		if err != nil {
+			log.Printf("ListCanceledEvents failed: %v", err)
+			return
+		}
+		b.sendPageCmdCancel(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, cancelEvents, page)
 
-	case len(data) >= 14 && data[:14] == "cmdHistoryPage":
-		page, err := strconv.Atoi(data[14:])
+	case strings.HasPrefix(data, "cmdHistoryPage"):
+		// 翻页时重新读取活动列表，按钮中携带 /history 的群组筛选条件
+		page, groupID, err := parseGroupPageData(strings.TrimPrefix(data, "cmdHistoryPage"))
 		if err != nil {
 			log.Printf("Invalid page number: %v", err)
 			return
 		}
-		b.sendPageCmdHistory(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+		if !b.hasPermission(userID, permView, groupID) {
+			log.Printf("user %d has no permission to view history events", userID)
+			return
+		}
+		allEvents, err := b.listHistoryEvents(groupID)
+		if err != nil {
+			log.Printf("listHistoryEvents: %v", err)
+			return
+		}
+		b.sendPageCmdHistory(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, allEvents, groupID, page)
 
 	case len(data) >= 10 && data[:10] == "cmdSeePage":
 		page, err := strconv.Atoi(data[10:])
@@ -124,44 +204,107 @@ func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 			log.Printf("Invalid page number: %v", err)
 			return
 		}
-		b.sendPageCmdSee(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+		b.sendPageCmdSee(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, userID, page)
+
+	case strings.HasPrefix(data, "seeDetail_"):
+		// seeDetail_<活动ID>_<返回的页码>
+		eventID, pageStr, ok := strings.Cut(strings.TrimPrefix(data, "seeDetail_"), "_")
+		page, err := strconv.Atoi(pageStr)
+		if !ok || err != nil {
+			log.Printf("Invalid see detail data: %s", data)
+			return
+		}
+		b.sendSeeDetail(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, userID, eventID, page)
+
+	case strings.HasPrefix(data, "cmdPrizePage"):
+		page, err := strconv.Atoi(strings.TrimPrefix(data, "cmdPrizePage"))
+		if err != nil {
+			log.Printf("Invalid page number: %v", err)
+			return
+		}
+		// /prize 是普通用户的指令，只显示点击按钮的用户自己的中奖记录，无需管理员权限
+		winInfoList, err := b.store.ListWinsByUser(userID)
+		if err != nil {
+			log.Printf("ListWinsByUser failed: %v", err)
+			return
+		}
+		b.sendPageCmdPrize(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, winInfoList, page)
+
+	case strings.HasPrefix(data, "cmdListPage"):
+		if !b.hasPermission(userID, permView, 0) {
+			log.Printf("user %d has no permission to view prizes", userID)
+			return
+		}
+		page, err := strconv.Atoi(strings.TrimPrefix(data, "cmdListPage"))
+		if err != nil {
+			log.Printf("Invalid page number: %v", err)
+			return
+		}
+		prizeList, err := b.store.ListAvailablePrizes()
+		if err != nil {
+			log.Printf("ListAvailablePrizes failed: %v", err)
+			return
+		}
+		b.sendPageCmdList(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, prizeList, page)
+
+	case strings.HasPrefix(data, "join_"):
+		// 参与按钮自行应答回调，以弹出提示告知结果
+		b.handleJoinCallback(callbackQuery)
+		return
+
+	case strings.HasPrefix(data, "claim_"):
+		// 领取按钮自行应答回调，以弹出提示告知结果
+		b.handleClaimCallback(callbackQuery)
+		return
 
-	case len(data) >= 12 && data[:12] == "cmdPrizePage":
-		page, err := strconv.Atoi(data[12:])
+	case strings.HasPrefix(data, "cmdUndeliveredPage"):
+		page, err := strconv.Atoi(strings.TrimPrefix(data, "cmdUndeliveredPage"))
 		if err != nil {
 			log.Printf("Invalid page number: %v", err)
+			return
 		}
-		b.sendPageCmdPrize(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+		b.sendPageCmdUndelivered(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, userID, page)
 
-	case len(data) >= 11 && data[:11] == "cmdListPage":
-		page, err := strconv.Atoi(data[11:])
+	case strings.HasPrefix(data, "cmdBanlistPage"):
+		if !b.hasPermission(userID, permView, 0) {
+			log.Printf("user %d has no permission to view bans", userID)
+			return
+		}
+		page, err := strconv.Atoi(strings.TrimPrefix(data, "cmdBanlistPage"))
 		if err != nil {
 			log.Printf("Invalid page number: %v", err)
+			return
+		}
+		b.sendPageCmdBanlist(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
+
+	case strings.HasPrefix(data, "resend_"):
+		// 重发按钮自行应答回调，以弹出提示告知结果
+		b.handleResendCallback(callbackQuery)
+		return
+
+	case strings.HasPrefix(data, "wizard_"):
+		err := b.handleWizardCallback(callbackQuery)
+		if err != nil {
+			log.Printf("handleWizardCallback failed: %v", err)
 		}
-		b.sendPageCmdList(callbackQuery.Message.Chat.ID, callbackQuery.Message.MessageID, page)
 
 	case data == "confirm_create_event":
-		if len(b.EventInfoMap) == 0 {
+		state, eventInfo, ok := b.getWizardState(userID)
+		if !ok || state != wizardStateConfirm {
 			err := b.sendReply(callbackQuery.Message, "无效，请重新创建")
 			if err != nil {
 				log.Printf("sendReply failed: %v", err)
 			}
-			return
-		}
-		// 初始化数据库
-		db, err := initDB()
-		if err != nil {
-			log.Printf("initDB failed: %v", err)
-			return
+			break
 		}
-		defer func() {
-			if err := db.Close(); err != nil {
-				log.Printf("close db err: %v", err)
+		if !b.hasPermission(userID, permManageEvents, b.eventChatID(eventInfo)) {
+			err := b.sendReply(callbackQuery.Message, "你没有在此群组发布活动的权限")
+			if err != nil {
+				log.Printf("sendReply failed: %v", err)
 			}
-		}()
-
-		eventInfo := b.EventInfoMap[callbackQuery.Message.Chat.ID]
-		if eventInfo.PrizeResultMethod == "1" {
+			break
+		}
+		if drawsAtTime(eventInfo) {
 			err := CheckTime(eventInfo.TimeOfWinners)
 			if err != nil {
 				err = b.sendReply(callbackQuery.Message, err.Error())
@@ -171,8 +314,8 @@ func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 				return
 			}
 		}
-		// 保存活动到数据库
-		err = saveEventsInformation(db, eventInfo)
+		// 保存活动并预留奖品，两者在同一事务中完成
+		err := b.createEvent(&eventInfo)
 		if err != nil {
 			log.Printf("save CreateInformation to Database ERROR: %v", err)
 			err = b.sendReply(callbackQuery.Message, err.Error())
@@ -181,47 +324,31 @@ func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 			}
 			return
 		}
+		// 活动已保存，清理用户状态，避免重复发布
+		b.clearWizardState(userID)
 
 		// 发布抽奖活动到群组
-		sentGroupMsg := fmt.Sprintf(
-			"🎉 <b>新的抽奖活动发布啦</b> 🎁\n"+
-				"<b>抽奖群：</b> %s\n"+
-				"<b>奖品名称：</b> %s\n"+
-				"<b>奖品数量：</b> %d\n"+
-				"<b>开奖方式：</b> %s\n"+
-				"<b>参与方式：</b> %s\n",
-			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.GroupName),
-			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeName),
-			eventInfo.PrizeCount,
-			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.PrizeResult),
-			tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.Participate),
-		)
+		sentGroupMsg := b.formatAnnouncement(eventInfo) + formatAnnouncementStatus(eventInfo, 0)
 
-		if eventInfo.HowToParticipate == "1" {
-			sentGroupMsg += fmt.Sprintf("<b>关键词：</b> <code>%s</code>\n<b>参与抽奖指令：</b> <code>/join %v</code>\n",
-				tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.KeyWord),
-				tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.KeyWord),
-			)
+		// 群组内参与的活动附带参与按钮，点击即可参与；私聊参与的活动附带跳转到机器人的链接
+		announcement := tgbotapi.NewMessage(b.eventChatID(eventInfo), sentGroupMsg)
+		announcement.ParseMode = tgbotapi.ModeHTML
+		if keyboard := b.announcementKeyboard(eventInfo, 0); keyboard != nil {
+			announcement.ReplyMarkup = *keyboard
 		}
-
-		if eventInfo.PrizeResultMethod == "1" {
-			sentGroupMsg += fmt.Sprintf("<b>开奖时间：</b> <code>%s</code> %v\n",
-				tgbotapi.EscapeText(tgbotapi.ModeHTML, eventInfo.TimeOfWinners),
-				config.TimeZone,
-			)
-		} else if eventInfo.PrizeResultMethod == "2" {
-			sentGroupMsg += fmt.Sprintf("<b>开奖人数：</b> %d\n", eventInfo.NumberOfWinners)
-		}
-
-		if eventInfo.HowToParticipate == "2" {
-			sentGroupMsg += "<b>参与抽奖指令：</b> <code>/join</code>\n"
-		}
-
-		err = b.sendMsgToGroup(sentGroupMsg)
+		sentMsg, err := b.Bot.Send(announcement)
 		if err != nil {
 			log.Printf("Error sending msg to group: %v", err)
 			return
 		}
+		// 记录公告消息，之后定时更新参与人数和开奖倒计时
+		err = b.store.SetAnnounceMessageID(eventInfo.ID, sentMsg.MessageID)
+		if err != nil {
+			log.Printf("SetAnnounceMessageID failed: %v", err)
+		}
+		b.announceMu.Lock()
+		b.announceTexts[eventInfo.ID] = sentGroupMsg
+		b.announceMu.Unlock()
 
 		err = b.sendReply(callbackQuery.Message, "抽奖活动已发布！")
 		if err != nil {
@@ -229,39 +356,19 @@ func (b *Bot) handleCallbackQuery(callbackQuery *tgbotapi.CallbackQuery) {
 			return
 		}
 
-		// 去除奖品文件中已经选择的奖品
-		err = ReplaceUnChoosePrizes(eventInfo.AllPrizes, eventInfo.ChoosePrizes)
-		if err != nil {
-			log.Printf("ReplaceUnChoosePrizes err %v\n", err)
-			return
-		}
 		// 刷新新的活动开奖的时间定时
 		err = b.regularPrizeDraw()
 		if err != nil {
 			log.Printf("regularPrizeDraw err %v\n", err)
 			return
 		}
-		// 清理用户状态
-		b.userStatesMu.Lock()
-		delete(b.UserStates, userID)
-		b.userStatesMu.Unlock()
-
-		b.eventInfoMapMu.Lock()
-		delete(b.EventInfoMap, userID)
-		b.eventInfoMapMu.Unlock()
 	case data == "cancel_create_event":
 		err := b.sendReply(callbackQuery.Message, "抽奖活动创建已取消。")
 		if err != nil {
 			log.Printf("Error sending reply: %v", err)
 		}
 		// 清理用户状态
-		b.userStatesMu.Lock()
-		delete(b.UserStates, userID)
-		b.userStatesMu.Unlock()
-
-		b.eventInfoMapMu.Lock()
-		delete(b.EventInfoMap, userID)
-		b.eventInfoMapMu.Unlock()
+		b.clearWizardState(userID)
 	default:
 		log.Printf("Invalid callback query: %v", data)
 	}
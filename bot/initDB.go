@@ -4,14 +4,29 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"log"
 	"os"
-	"path/filepath"
 )
 
-// 初始化数据库
-func initDB() (*sql.DB, error) {
+// dbExecutor 由 *sql.DB 和 *sql.Tx 共同实现，便于同一段SQL在事务内外复用
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// 数据库忙时等待锁释放的最长时间，单位为毫秒
+const dbBusyTimeout = 5000
+
+const (
+	dbFolderPath = "./.db"                   // 数据库文件夹
+	dbFilePath   = dbFolderPath + "/info.db" // 数据库文件路径
+)
+
+// 连接数据库，不检查表结构
+func connectDB() (*sql.DB, error) {
 	// 确保 .db 文件夹存在
-	dbFolderPath := "./.db"
 	if _, err := os.Stat(dbFolderPath); os.IsNotExist(err) {
 		err = os.Mkdir(dbFolderPath, os.ModePerm)
 		if err != nil {
@@ -19,85 +34,128 @@ func initDB() (*sql.DB, error) {
 		}
 	}
 
-	// 数据库文件路径
-	dbFilePath := filepath.Join(dbFolderPath, "info.db")
-
-	// 连接到 SQLite 数据库
-	db, err := sql.Open("sqlite3", dbFilePath)
+	// 连接到 SQLite 数据库，事务开始时即获取写锁，避免并发开奖时互相覆盖
+	// 使用 WAL 模式使读写互不阻塞，写入冲突时等待而不是立即返回 database is locked
+	dsn := fmt.Sprintf("%s?_txlock=immediate&_journal_mode=WAL&_busy_timeout=%d", dbFilePath, dbBusyTimeout)
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("无法打开数据库连接: %v", err)
 	}
+	return db, nil
+}
 
-	// 创建抽奖活动表
-	sqlStmtEvents := `
-	CREATE TABLE IF NOT EXISTS events (
-		id TEXT PRIMARY KEY,
-		group_name TEXT,
-		prize_name TEXT,
-		prize_result_method TEXT,
-		prize_result TEXT,
-		how_to_participate TEXT,
-		participate TEXT,
-		key_word TEXT,
-		prizes_list TEXT,
-		time_of_winners TEXT,
-		all_prizes TEXT,
-		choose_prizes TEXT,
-		prize_count INTEGER,
-		number_of_winners INTEGER,
-		open_status BOOLEAN,
-		cancel_status BOOLEAN
-	);
-	`
+// 打开数据库并执行未应用的迁移，机器人运行期间共用这一个连接池
+func openDB() (*sql.DB, error) {
+	db, err := connectDB()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err = db.Exec(sqlStmtEvents)
+	_, err = migrateUp(db)
 	if err != nil {
-		err = db.Close()
-		if err != nil {
-			return nil, err
+		if closeErr := db.Close(); closeErr != nil {
+			log.Printf("close db err: %v", closeErr)
 		}
-		return nil, fmt.Errorf("无法创建活动表: %v", err)
+		return nil, fmt.Errorf("无法更新表结构: %v", err)
 	}
+	return db, nil
+}
 
-	// 创建参与者表
-	sqlStmtParticipants := `
-	CREATE TABLE IF NOT EXISTS participants (
-		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		user_name TEXT,
-		event_id TEXT,
-		FOREIGN KEY (event_id) REFERENCES events(id)
-	);
-	`
+// 打开数据库并返回基于它的 Store
+func openStore() (Store, error) {
+	db, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+	return newSQLiteStore(db), nil
+}
 
-	_, err = db.Exec(sqlStmtParticipants)
+// 检查表是否存在
+func tableExists(db dbExecutor, table string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
 	if err != nil {
-		err = db.Close()
+		return false, fmt.Errorf("query sqlite_master error: %v", err)
+	}
+	return count > 0, nil
+}
+
+// 为迁移系统之前的旧版本数据库补充后来新增的列，此后的表结构变更都通过迁移完成
+func upgradeLegacySchema(db dbExecutor) error {
+	legacyColumns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"events", "seed", "TEXT NOT NULL DEFAULT ''"},
+		{"events", "seed_commitment", "TEXT NOT NULL DEFAULT ''"},
+		{"participants", "joined_at", "DATETIME"},
+		{"events", "tiers", "TEXT NOT NULL DEFAULT '[]'"},
+		{"luckyUser", "tier_index", "INTEGER NOT NULL DEFAULT 0"},
+		{"luckyUser", "tier_name", "TEXT NOT NULL DEFAULT ''"},
+		{"prizes", "pool", "TEXT NOT NULL DEFAULT ''"},
+		{"events", "chat_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"events", "announce_message_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"events", "required_chats", "TEXT NOT NULL DEFAULT '[]'"},
+		{"participants", "eligible", "BOOLEAN NOT NULL DEFAULT 1"},
+		{"participants", "ineligible_reason", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range legacyColumns {
+		exists, err := tableExists(db, c.table)
+		if err != nil {
+			return err
+		}
+		// 表不存在时由初始迁移创建完整的表
+		if !exists {
+			continue
+		}
+		err = addColumnIfNotExists(db, c.table, c.column, c.definition)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return nil, fmt.Errorf("无法创建参与者表: %v", err)
 	}
+	return nil
+}
 
-	// 创建中奖者表
-	sqlStmtLuckyUser := `
-	CREATE TABLE IF NOT EXISTS luckyUser (
-		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER,
-		user_name TEXT,
-		prize_info TEXT,
-		event_id TEXT,
-		FOREIGN KEY (event_id) REFERENCES events(id)
-	);
-	`
-
-	_, err = db.Exec(sqlStmtLuckyUser)
+// 当表中不存在指定列时添加该列
+func addColumnIfNotExists(db dbExecutor, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		err = db.Close()
-		if err != nil {
-			return nil, err
+		return fmt.Errorf("query table info error: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close err: %v", err)
+		}
+	}()
+
+	found := false
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("scan table info error: %v", err)
+		}
+		if name == column {
+			found = true
 		}
-		return nil, fmt.Errorf("无法创建中奖者表: %v", err)
 	}
-	return db, nil
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("query table info error: %v", err)
+	}
+	if found {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("add column %s.%s error: %v", table, column, err)
+	}
+	return nil
 }
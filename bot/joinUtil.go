@@ -0,0 +1,228 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strings"
+)
+
+// 将用户登记为活动的参与者，返回是否为新参与以及登记后的参与人数
+func joinEvent(store ParticipantStore, info EventInformation, partner Partner) (joined bool, count int, err error) {
+	joined, count, err = store.AddParticipant(info.ID, partner)
+	if err != nil {
+		return false, 0, fmt.Errorf("AddParticipant: %w", err)
+	}
+	return joined, count, nil
+}
+
+// 按人数开奖的活动在参与人数达到开奖人数时开奖，返回是否已开奖
+// count 须为本次新参与时登记后的人数；达到开奖人数时的开奖失败后，之后的参与者会再次触发开奖，
+// 同一活动由开奖事务保证只会被成功开奖一次
+func (b *Bot) drawIfThresholdReached(info EventInformation, count int) (bool, error) {
+	if !drawsAtCount(info) || count < info.NumberOfWinners {
+		return false, nil
+	}
+	err := b.prizeDraw(info.ID)
+	// 开奖前复查参与条件后人数不足，活动已延长开奖时间，继续接受参与
+	if errors.Is(err, errDrawExtended) {
+		return false, nil
+	}
+	// 同时参与的其他用户已触发开奖
+	if errors.Is(err, errEventAlreadyOpened) {
+		return true, nil
+	}
+	return true, err
+}
+
+// 生成参与成功的回复，Markdown 格式
+func formatJoinReply(info EventInformation, count int) string {
+	replyMessage := fmt.Sprintf("🎉*你已成功参与活动:*🎉\n\n*🎟️ 活动 ID:* `%s`\n*🏷️ 活动名称:* %s\n*🎁 奖品数量:* %d\n",
+		info.ID, info.PrizeName, info.PrizeCount)
+
+	if info.PrizeResultMethod == "1" { // 按时间开奖
+		replyMessage += fmt.Sprintf("*⏰ 开奖时间:* %s %s\n*👥 参与人数:* %d\n", info.TimeOfWinners, config.TimeZone, count)
+	} else if info.PrizeResultMethod == "2" { // 按人数开奖
+		replyMessage += fmt.Sprintf("*🏆 开奖人数:* %d\n*👥 参与人数:* %d\n", info.NumberOfWinners, count)
+	} else if info.PrizeResultMethod == "3" { // 按时间或人数开奖
+		replyMessage += fmt.Sprintf("*⏰ 开奖时间:* %s %s\n*🏆 开奖人数:* %d\n*👥 参与人数:* %d\n",
+			info.TimeOfWinners, config.TimeZone, info.NumberOfWinners, count)
+	}
+
+	if info.HowToParticipate == "1" {
+		replyMessage += fmt.Sprintf("*📲 参与方式:* %s\n*🔑 关键词:* `%s`\n", info.Participate, info.KeyWord)
+	} else if info.HowToParticipate == "2" {
+		replyMessage += fmt.Sprintf("*📲 参与方式:* %s\n", info.Participate)
+	}
+	return replyMessage
+}
+
+// 私聊参与的活动通过此链接启动机器人参与，可以同时进行多个私聊参与的活动
+func (b *Bot) joinDeepLink(eventID string) string {
+	return fmt.Sprintf("https://t.me/%s?start=join_%s", b.Bot.Self.UserName, eventID)
+}
+
+// 活动公告上的按钮：群组内参与的活动为参与按钮，私聊参与的活动为跳转到机器人的链接按钮，其他活动没有按钮
+func (b *Bot) announcementKeyboard(info EventInformation, count int) *tgbotapi.InlineKeyboardMarkup {
+	var keyboard tgbotapi.InlineKeyboardMarkup
+	switch info.HowToParticipate {
+	case "1":
+		keyboard = joinButtonKeyboard(info.ID, count)
+	case "2":
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("私聊机器人参与", b.joinDeepLink(info.ID)),
+		))
+	default:
+		return nil
+	}
+	return &keyboard
+}
+
+// 活动公告上的参与按钮，按钮上显示当前的参与人数
+func joinButtonKeyboard(eventID string, count int) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("参与抽奖（%d 人）", count), "join_"+eventID),
+	))
+}
+
+// 用户通过 start=join_<活动ID> 启动机器人时参与指定的活动
+func (b *Bot) startJoin(msg *tgbotapi.Message, eventID string) error {
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中发送")
+	}
+	info, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return b.sendReply(msg, "活动不存在: "+eventID)
+	}
+	if info.OpenStatus || info.CancelStatus {
+		return b.sendReply(msg, "活动已结束: "+info.ID)
+	}
+	if info.HowToParticipate != "2" {
+		return b.sendReply(msg, "此活动需要在抽奖群中发送关键词或点击活动公告下方的按钮参与")
+	}
+
+	reason, err := b.checkJoinEligibility(info, msg.From.ID)
+	if err != nil {
+		log.Printf("checkJoinEligibility: %v", err)
+		return b.sendReply(msg, "暂时无法验证参与条件，请稍后再试")
+	}
+	if reason != "" {
+		return b.sendReply(msg, reason)
+	}
+
+	partner := Partner{
+		UserID:   msg.From.ID,
+		UserName: msg.From.UserName,
+	}
+	joined, count, err := joinEvent(b.store, info, partner)
+	if errors.Is(err, errEventClosed) {
+		return b.sendReply(msg, "活动已结束: "+info.ID)
+	}
+	if err != nil {
+		log.Printf("joinEvent: %v", err)
+		return b.sendReply(msg, err.Error())
+	}
+	if !joined {
+		return b.sendReply(msg, "你已经参与过活动: "+info.ID)
+	}
+
+	err = b.sendReplyMarkDown(msg, formatJoinReply(info, count))
+	if err != nil {
+		return err
+	}
+
+	// 人数到了自动开奖
+	_, err = b.drawIfThresholdReached(info, count)
+	if err != nil {
+		log.Printf("prizeDraw: %v", err)
+		return b.sendReply(msg, "❌ 参与者数量不足或系统出现严重错误，开奖失败，请联系管理员！")
+	}
+	return nil
+}
+
+// 处理活动公告上的参与按钮，结果以弹出提示的方式告知用户，不在群组中回复
+func (b *Bot) handleJoinCallback(callbackQuery *tgbotapi.CallbackQuery) {
+	eventID := strings.TrimPrefix(callbackQuery.Data, "join_")
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	answer := func(text string) {
+		if _, err := b.Bot.Request(tgbotapi.NewCallback(callbackQuery.ID, text)); err != nil {
+			log.Printf("Error sending callback: %v", err)
+		}
+	}
+
+	info, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		answer("活动不存在")
+		return
+	}
+
+	if info.OpenStatus || info.CancelStatus {
+		answer("活动已结束")
+		// 移除已结束活动的参与按钮
+		editMarkup := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+		if _, err := b.Bot.Request(editMarkup); err != nil {
+			log.Printf("remove join button failed: %v", err)
+		}
+		return
+	}
+
+	if chatID != b.eventChatID(info) {
+		answer("此活动不属于当前群组")
+		return
+	}
+
+	reason, err := b.checkJoinEligibility(info, callbackQuery.From.ID)
+	if err != nil {
+		log.Printf("checkJoinEligibility: %v", err)
+		answer("暂时无法验证参与条件，请稍后再试")
+		return
+	}
+	if reason != "" {
+		answer(reason)
+		return
+	}
+
+	partner := Partner{
+		UserID:   callbackQuery.From.ID,
+		UserName: callbackQuery.From.UserName,
+	}
+	joined, count, err := joinEvent(b.store, info, partner)
+	if errors.Is(err, errEventClosed) {
+		answer("活动已结束")
+		return
+	}
+	if err != nil {
+		log.Printf("joinEvent: %v", err)
+		answer("参与失败，请稍后再试")
+		return
+	}
+	if !joined {
+		answer("你已经参与过此活动")
+		return
+	}
+
+	if drawsAtCount(info) && count == info.NumberOfWinners {
+		answer("🎉 参与成功！参与人数已满，即将开奖")
+	} else {
+		answer("🎉 参与成功！")
+	}
+
+	// 按钮上的参与人数由 announcementLoop 随公告一起刷新，避免每次参与都编辑公告触发 Telegram 的频率限制
+
+	drawn, err := b.drawIfThresholdReached(info, count)
+	if err != nil {
+		log.Printf("prizeDraw: %v", err)
+		return
+	}
+	if drawn {
+		editMarkup := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+		if _, err := b.Bot.Request(editMarkup); err != nil {
+			log.Printf("remove join button failed: %v", err)
+		}
+	}
+}
@@ -21,19 +21,7 @@ func (b *Bot) listenKeyWordMsg(msg *tgbotapi.Message) error {
 
 	// 处理 "抽奖" 关键字
 	if strings.Contains(msg.Text, "抽奖") {
-		// 初始化数据库
-		db, err := initDB()
-		if err != nil {
-			log.Printf("无法连接到数据库: %v", err)
-			return err
-		}
-		defer func() {
-			if err := db.Close(); err != nil {
-				log.Printf("关闭数据库连接失败: %v", err)
-			}
-		}()
-
-		allEventInfo, err := loadAllEvents(db)
+		allEventInfo, err := b.store.ListEvents()
 		if err != nil {
 			log.Println(err)
 			return err
@@ -41,10 +29,11 @@ func (b *Bot) listenKeyWordMsg(msg *tgbotapi.Message) error {
 
 		var outputMsg string
 		var count int
-		for _, val := range allEventInfo {
+		// 只展示属于当前群组的活动
+		for _, val := range b.filterEventsByGroup(allEventInfo, msg.Chat.ID) {
 			if !val.CancelStatus && !val.OpenStatus {
 				// 获取参与人数
-				NumberOfParticipants, err := getParticipantCountByEventID(db, val.ID)
+				NumberOfParticipants, err := b.store.CountParticipants(val.ID)
 				if err != nil {
 					log.Printf(err.Error())
 				}
@@ -56,6 +45,9 @@ func (b *Bot) listenKeyWordMsg(msg *tgbotapi.Message) error {
 					eventMsg += fmt.Sprintf("*⏰ 开奖时间：* `%v` %v\n*👤 参与人数：* %v\n", val.TimeOfWinners, config.TimeZone, NumberOfParticipants)
 				} else if val.PrizeResultMethod == "2" {
 					eventMsg += fmt.Sprintf("*🏅 开奖人数：* %v\n*👤 参与人数：* %v\n", val.NumberOfWinners, NumberOfParticipants)
+				} else if val.PrizeResultMethod == "3" {
+					eventMsg += fmt.Sprintf("*⏰ 开奖时间：* `%v` %v\n*🏅 开奖人数：* %v\n*👤 参与人数：* %v\n",
+						val.TimeOfWinners, config.TimeZone, val.NumberOfWinners, NumberOfParticipants)
 				}
 				if val.HowToParticipate == "1" {
 					eventMsg += fmt.Sprintf("*🔑 抽奖关键词：* %v\n*📩 参与抽奖指令:* `/join %v`\n", val.KeyWord, val.KeyWord)
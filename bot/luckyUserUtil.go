@@ -4,36 +4,49 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
 	"strings"
 )
 
-// 保存中奖者信息
-func saveLuckyUser(db *sql.DB, luckyUser LuckyUser, eventID string) error {
+// 中奖者表的查询列，顺序与 scanLuckyUser 的扫描顺序一致
+const luckyUserColumns = `id, user_id, user_name, prize_info, event_id, tier_index, tier_name,
+	claim_status, IFNULL(claim_deadline, ''), alternate_position, delivery_status, delivery_error`
+
+// 按 luckyUserColumns 的顺序扫描一行中奖者信息
+func scanLuckyUser(row rowScanner) (luckyUser LuckyUser, err error) {
+	err = row.Scan(&luckyUser.ID, &luckyUser.UserID, &luckyUser.UserName, &luckyUser.PrizeInfo, &luckyUser.EventID,
+		&luckyUser.TierIndex, &luckyUser.TierName, &luckyUser.ClaimStatus, &luckyUser.ClaimDeadline, &luckyUser.AlternatePosition,
+		&luckyUser.DeliveryStatus, &luckyUser.DeliveryError)
+	return luckyUser, err
+}
+
+// 保存中奖者信息，中奖通知为待发送状态，返回中奖记录的ID
+func (s *sqliteStore) SaveWinner(eventID string, luckyUser LuckyUser) (int64, error) {
 	sqlStmt := `
-	INSERT INTO luckyUser (user_id, user_name, prize_info, event_id) 
-	VALUES (?, ?, ?, ?);
+	INSERT INTO luckyUser (user_id, user_name, prize_info, event_id, tier_index, tier_name,
+		claim_status, claim_deadline, alternate_position, delivery_status)
+	VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?);
 	`
 
-	_, err := db.Exec(sqlStmt, luckyUser.UserID, luckyUser.UserName, luckyUser.PrizeInfo, eventID)
+	result, err := s.db.Exec(sqlStmt, luckyUser.UserID, luckyUser.UserName, luckyUser.PrizeInfo, eventID, luckyUser.TierIndex, luckyUser.TierName,
+		luckyUser.ClaimStatus, luckyUser.ClaimDeadline, luckyUser.AlternatePosition, deliveryStatusPending)
 	if err != nil {
 		log.Printf("无法保存活动ID %s 的中奖者信息: %v", eventID, err)
-		return fmt.Errorf("无法保存中奖者信息，请稍后再试")
+		return 0, fmt.Errorf("无法保存中奖者信息，请稍后再试")
 	}
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("无法保存中奖者信息: %v", err)
+	}
+	return id, nil
 }
 
-// 查找指定活动ID下的中奖者信息
-func getLuckyUsersListByEventID(db *sql.DB, eventID string) ([]LuckyUser, error) {
-	query := `
-	SELECT user_id, user_name ,prize_info
-	FROM luckyUser
-	WHERE event_id = ?;
-	`
-
-	rows, err := db.Query(query, eventID)
+// 查询中奖记录，query 须按 luckyUserColumns 的顺序返回列
+func (s *sqliteStore) queryLuckyUsers(query string, args ...any) ([]LuckyUser, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		log.Printf("查询活动ID %s 的中奖者信息失败: %v", eventID, err)
+		log.Printf("查询中奖者信息失败: %v", err)
 		return nil, fmt.Errorf("无法获取中奖者信息，请稍后再试")
 	}
 	defer func() {
@@ -44,83 +57,141 @@ func getLuckyUsersListByEventID(db *sql.DB, eventID string) ([]LuckyUser, error)
 
 	var luckyUserList []LuckyUser
 	for rows.Next() {
-		var luckyUser LuckyUser
-		err := rows.Scan(&luckyUser.UserID, &luckyUser.UserName, &luckyUser.PrizeInfo)
+		luckyUser, err := scanLuckyUser(rows)
 		if err != nil {
-			log.Printf("读取活动ID %s 的中奖者信息失败: %v", eventID, err)
+			log.Printf("读取中奖者信息失败: %v", err)
 			return nil, fmt.Errorf("无法获取中奖者信息，请稍后再试")
 		}
 		luckyUserList = append(luckyUserList, luckyUser)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("遍历活动ID %s 的中奖者信息时出错: %v", eventID, err)
+		log.Printf("遍历中奖者信息时出错: %v", err)
 		return nil, fmt.Errorf("无法获取中奖者信息，请稍后再试")
 	}
 
 	return luckyUserList, nil
 }
 
-// 通过活动ID查询所有中奖者组成的字符串
-func getAllLuckyUserName(db *sql.DB, eventID string) (AllLuckyUserName string, err error) {
-	LuckyUserNameList, err := getLuckyUserNameListByEventID(db, eventID)
+// 查找指定活动ID下当前的中奖者信息，逾期未领取的中奖者不返回
+func (s *sqliteStore) ListWinners(eventID string) ([]LuckyUser, error) {
+	return s.queryLuckyUsers("SELECT "+luckyUserColumns+" FROM luckyUser WHERE event_id = ? AND claim_status != ? ORDER BY id",
+		eventID, claimStatusExpired)
+}
+
+// 查找指定活动ID下的全部中奖记录，包括逾期未领取的中奖者和递补的候补
+func (s *sqliteStore) ListWinnerRecords(eventID string) ([]LuckyUser, error) {
+	return s.queryLuckyUsers("SELECT "+luckyUserColumns+" FROM luckyUser WHERE event_id = ? ORDER BY id", eventID)
+}
+
+// 查找中奖记录
+func (s *sqliteStore) GetWinner(id int64) (LuckyUser, error) {
+	luckyUser, err := scanLuckyUser(s.db.QueryRow("SELECT "+luckyUserColumns+" FROM luckyUser WHERE id = ?", id))
 	if err != nil {
-		return "", fmt.Errorf("getAllLuckyUserName ERROR: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return LuckyUser{}, fmt.Errorf("中奖记录不存在")
+		}
+		return LuckyUser{}, fmt.Errorf("GetWinner ERROR: %v", err)
 	}
-	// 为每个用户名添加 '@' 前缀
-	for i, userName := range LuckyUserNameList {
-		LuckyUserNameList[i] = "@" + userName
+	return luckyUser, nil
+}
+
+// 中奖者领取奖品，仅当记录属于该用户、待领取且未过领取期限时生效
+func (s *sqliteStore) ClaimPrize(id int64, userID int64) (bool, error) {
+	result, err := s.db.Exec(`
+	UPDATE luckyUser SET claim_status = ?, claimed_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND user_id = ? AND claim_status = ? AND claim_deadline > CURRENT_TIMESTAMP
+	`, claimStatusClaimed, id, userID, claimStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("ClaimPrize ERROR: %v", err)
 	}
-	// 将所有用户名连接成一个完整的字符串，每个用户名占一行
-	AllLuckyUserName = strings.Join(LuckyUserNameList, "\n")
-	return AllLuckyUserName, nil
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ClaimPrize ERROR: %v", err)
+	}
+	return affected == 1, nil
 }
 
-// 通过活动ID查询中奖者用户名列表
-func getLuckyUserNameListByEventID(db *sql.DB, eventID string) (luckyUserNameList []string, err error) {
-	// 查询数据库，获取指定活动ID对应的所有中奖者用户名
-	query := `
-	SELECT user_name 
-	FROM luckyUser 
-	WHERE event_id = ?;
-	`
+// 查找已过领取期限仍未领取的中奖记录
+func (s *sqliteStore) ListExpiredClaims() ([]LuckyUser, error) {
+	return s.queryLuckyUsers("SELECT "+luckyUserColumns+" FROM luckyUser WHERE claim_status = ? AND claim_deadline <= CURRENT_TIMESTAMP ORDER BY id",
+		claimStatusPending)
+}
 
-	rows, err := db.Query(query, eventID)
+// 将逾期未领取的中奖记录标记为已过期，记录已被领取或处理过时返回 false
+func (s *sqliteStore) ExpireClaim(id int64) (bool, error) {
+	result, err := s.db.Exec(`
+	UPDATE luckyUser SET claim_status = ?
+	WHERE id = ? AND claim_status = ? AND claim_deadline <= CURRENT_TIMESTAMP
+	`, claimStatusExpired, id, claimStatusPending)
 	if err != nil {
-		return nil, fmt.Errorf("error querying list of winner usernames for campaign ID %s: %v", eventID, err)
+		return false, fmt.Errorf("ExpireClaim ERROR: %v", err)
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("rows.Close err: %v", err)
-		}
-	}()
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ExpireClaim ERROR: %v", err)
+	}
+	return affected == 1, nil
+}
 
-	for rows.Next() {
-		var userName string
-		if err := rows.Scan(&userName); err != nil {
-			return nil, fmt.Errorf("error reading winner's username for campaign ID %s: %v", eventID, err)
-		}
-		luckyUserNameList = append(luckyUserNameList, userName)
+// 记录中奖通知的送达状态，送达时清除之前的失败原因
+func (s *sqliteStore) SetDeliveryStatus(id int64, status string, reason string) error {
+	_, err := s.db.Exec(`
+	UPDATE luckyUser SET delivery_status = ?, delivery_error = ?,
+		delivered_at = CASE WHEN ? = ? THEN CURRENT_TIMESTAMP ELSE delivered_at END
+	WHERE id = ?
+	`, status, reason, status, deliveryStatusDelivered, id)
+	if err != nil {
+		return fmt.Errorf("SetDeliveryStatus ERROR: %v", err)
 	}
+	return nil
+}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error traversing list of winner usernames for campaign ID %s: %v", eventID, err)
+// 查找中奖通知未送达的中奖记录，逾期未领取的记录不返回
+func (s *sqliteStore) ListUndelivered() ([]LuckyUser, error) {
+	return s.queryLuckyUsers("SELECT "+luckyUserColumns+" FROM luckyUser WHERE delivery_status IN (?, ?) AND claim_status != ? ORDER BY id",
+		deliveryStatusPending, deliveryStatusFailed, claimStatusExpired)
+}
+
+// 通过活动ID查询所有中奖者组成的字符串，设置了奖项时按奖项分组
+func getAllLuckyUserName(store WinnerStore, eventID string) (AllLuckyUserName string, err error) {
+	luckyUserList, err := store.ListWinners(eventID)
+	if err != nil {
+		return "", fmt.Errorf("getAllLuckyUserName ERROR: %v", err)
 	}
 
-	return luckyUserNameList, nil
+	var lines []string
+	lastTier := -1
+	for _, luckyUser := range luckyUserList {
+		// 每个奖项的中奖者前加上奖项名称
+		if luckyUser.TierName != "" && luckyUser.TierIndex != lastTier {
+			lines = append(lines, fmt.Sprintf("【%s】", tgbotapi.EscapeText(tgbotapi.ModeHTML, luckyUser.TierName)))
+			lastTier = luckyUser.TierIndex
+		}
+		// 为每个用户名添加 '@' 前缀
+		lines = append(lines, "@"+luckyUser.UserName)
+	}
+	// 将所有用户名连接成一个完整的字符串，每个用户名占一行
+	AllLuckyUserName = strings.Join(lines, "\n")
+	return AllLuckyUserName, nil
 }
 
-func getWinInfoByUserID(db *sql.DB, userID int64) ([]winInfo, error) {
+// 查询用户的中奖记录及对应的活动信息
+func (s *sqliteStore) ListWinsByUser(userID int64) ([]winInfo, error) {
 	// 定义返回的切片
 	var winInfos []winInfo
 
-	// 查询用户的中奖记录
-	queryLuckyUser := `
-	SELECT user_id, user_name, prize_info, event_id
+	// 查询用户的中奖记录，活动已不存在的记录和逾期未领取的记录不返回
+	query := `
+	SELECT events.id, events.group_name, events.prize_name, events.prize_result_method, events.how_to_participate,
+	       events.key_word, events.prizes_list, events.time_of_winners, events.prize_count, events.number_of_winners,
+	       luckyUser.prize_info, luckyUser.tier_name, luckyUser.claim_status, IFNULL(luckyUser.claim_deadline, '')
 	FROM luckyUser
-	WHERE user_id = ?
+	INNER JOIN events ON luckyUser.event_id = events.id
+	WHERE luckyUser.user_id = ? AND luckyUser.claim_status != ?
+	ORDER BY luckyUser.id
 	`
-	rows, err := db.Query(queryLuckyUser, userID)
+	rows, err := s.db.Query(query, userID, claimStatusExpired)
 	if err != nil {
 		return nil, fmt.Errorf("查询用户中奖记录失败: %v", err)
 	}
@@ -132,47 +203,41 @@ func getWinInfoByUserID(db *sql.DB, userID int64) ([]winInfo, error) {
 
 	// 遍历中奖记录
 	for rows.Next() {
-		var luckyUser LuckyUser
-		err = rows.Scan(&luckyUser.UserID, &luckyUser.UserName, &luckyUser.PrizeInfo, &luckyUser.EventID)
+		var win winInfo
+		err = rows.Scan(&win.ID, &win.GroupName, &win.PrizeName, &win.PrizeResultMethod, &win.HowToParticipate,
+			&win.KeyWord, &win.PrizesList, &win.TimeOfWinners, &win.PrizeCount, &win.NumberOfWinners,
+			&win.PrizeInfo, &win.TierName, &win.ClaimStatus, &win.ClaimDeadline)
 		if err != nil {
 			return nil, fmt.Errorf("扫描中奖记录失败: %v", err)
 		}
-
-		// 查询对应的活动信息
-		var event EventInformation
-		queryEvent := `
-		SELECT id, group_name, prize_name, prize_result_method, how_to_participate, key_word, prizes_list, time_of_winners, prize_count, number_of_winners
-		FROM events
-		WHERE id = ?
-		`
-		err = db.QueryRow(queryEvent, luckyUser.EventID).Scan(
-			&event.ID, &event.GroupName, &event.PrizeName, &event.PrizeResultMethod, &event.HowToParticipate,
-			&event.KeyWord, &event.PrizesList, &event.TimeOfWinners, &event.PrizeCount, &event.NumberOfWinners)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				continue
-			}
-			return nil, fmt.Errorf("查询活动信息失败: %w", err)
-		}
-
-		// 将数据填充到 winInfo 结构体中
-		win := winInfo{
-			ID:                event.ID,
-			GroupName:         event.GroupName,
-			PrizeName:         event.PrizeName,
-			PrizeResultMethod: event.PrizeResultMethod,
-			HowToParticipate:  event.HowToParticipate,
-			KeyWord:           event.KeyWord,
-			PrizesList:        event.PrizesList,
-			TimeOfWinners:     event.TimeOfWinners,
-			PrizeCount:        event.PrizeCount,
-			NumberOfWinners:   event.NumberOfWinners,
-			PrizeInfo:         luckyUser.PrizeInfo, // 将奖品信息添加到 winInfo
-		}
-
-		// 将 winInfo 添加到返回的切片中
 		winInfos = append(winInfos, win)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询用户中奖记录失败: %v", err)
+	}
 	return winInfos, nil
 }
+
+// 统计开奖时间不早于 since 的活动中每位用户的中奖次数，逾期未领取的记录不计入
+func (s *sqliteStore) CountWinsSince(since string) (map[int64]int, error) {
+	return s.queryUserCounts(`
+	SELECT luckyUser.user_id, COUNT(*)
+	FROM luckyUser
+	INNER JOIN events ON luckyUser.event_id = events.id
+	WHERE events.opened_at >= ? AND luckyUser.claim_status != ?
+	GROUP BY luckyUser.user_id
+	`, since, claimStatusExpired)
+}
+
+// 统计最近 n 场已开奖的活动中每位用户的中奖次数，旧版本开奖的活动没有开奖时间，按活动ID排在最后
+func (s *sqliteStore) CountWinsInRecentEvents(n int) (map[int64]int, error) {
+	return s.queryUserCounts(`
+	SELECT user_id, COUNT(*)
+	FROM luckyUser
+	WHERE claim_status != ? AND event_id IN (
+		SELECT id FROM events WHERE open_status = 1 ORDER BY opened_at DESC, id DESC LIMIT ?
+	)
+	GROUP BY user_id
+	`, claimStatusExpired, n)
+}
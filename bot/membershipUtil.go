@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strings"
+)
+
+// 解析必须加入的频道或群组，多个用英文逗号分割，填写用户名或会话ID，例如 @channel,-1001234567890
+func (b *Bot) parseRequiredChats(spec string) ([]RequiredChat, error) {
+	var chats []RequiredChat
+	for _, ref := range strings.Split(spec, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		chat, err := b.Bot.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: groupChatConfig(ref)})
+		if err != nil {
+			return nil, fmt.Errorf("无法获取频道或群组 %s，请确认机器人已加入并拥有管理员权限", ref)
+		}
+		chats = append(chats, RequiredChat{ID: chat.ID, Title: chat.Title, UserName: chat.UserName})
+	}
+	if len(chats) == 0 {
+		return nil, fmt.Errorf("没有有效的频道或群组")
+	}
+	return chats, nil
+}
+
+func requiredChatDisplayName(chat RequiredChat) string {
+	if chat.UserName != "" {
+		return "@" + chat.UserName
+	}
+	return chat.Title
+}
+
+// 生成参与条件的 HTML 描述，没有参与条件时返回空字符串
+func formatRequiredChatsHTML(chats []RequiredChat) string {
+	if len(chats) == 0 {
+		return ""
+	}
+	var names []string
+	for _, chat := range chats {
+		names = append(names, tgbotapi.EscapeText(tgbotapi.ModeHTML, requiredChatDisplayName(chat)))
+	}
+	return "<b>参与条件：</b> 需加入 " + strings.Join(names, "、") + "\n"
+}
+
+// 检查用户是否加入了所有必须加入的频道或群组，返回未加入的频道或群组
+func (b *Bot) checkMembership(userID int64, chats []RequiredChat) (missing []RequiredChat, err error) {
+	for _, chat := range chats {
+		member, err := b.Bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: userID},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("GetChatMember %d failed: %w", chat.ID, err)
+		}
+		// 受限制的成员仍在会话中时 IsMember 为 true
+		joined := member.IsCreator() || member.IsAdministrator() || member.Status == "member" ||
+			(member.Status == "restricted" && member.IsMember)
+		if !joined {
+			missing = append(missing, chat)
+		}
+	}
+	return missing, nil
+}
+
+// 参与活动前检查用户是否被禁止参与以及参与条件，不满足时返回给用户的提示
+func (b *Bot) checkJoinEligibility(info EventInformation, userID int64) (reason string, err error) {
+	ban, banned, err := b.store.GetActiveBan(userID, info.ID)
+	if err != nil {
+		return "", err
+	}
+	if banned {
+		return formatBanNotice(ban), nil
+	}
+	if len(info.RequiredChats) == 0 {
+		return "", nil
+	}
+	missing, err := b.checkMembership(userID, info.RequiredChats)
+	if err != nil {
+		return "", err
+	}
+	if len(missing) == 0 {
+		return "", nil
+	}
+	var names []string
+	for _, chat := range missing {
+		names = append(names, requiredChatDisplayName(chat))
+	}
+	return "请先加入 " + strings.Join(names, "、") + " 后再参与", nil
+}
+
+// 开奖前再次检查参与者是否仍满足参与条件，返回已退出者及原因
+// 只有确定开奖后才由 drawWinners 标记为失去资格，延长开奖时间后用户可能已重新加入
+// 无法获取成员信息时保留其资格，参与时已经检查过一次
+func (b *Bot) recheckEligibility(info EventInformation) (map[int64]string, error) {
+	if len(info.RequiredChats) == 0 {
+		return nil, nil
+	}
+
+	partnerList, err := b.store.ListParticipants(info.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ListParticipants failed: %w", err)
+	}
+
+	missingUsers := make(map[int64]string)
+	for _, partner := range partnerList {
+		missing, err := b.checkMembership(partner.UserID, info.RequiredChats)
+		if err != nil {
+			log.Printf("checkMembership of user %d failed: %v", partner.UserID, err)
+			continue
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		missingUsers[partner.UserID] = "已退出 " + requiredChatDisplayName(missing[0])
+	}
+	return missingUsers, nil
+}
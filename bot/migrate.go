@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 数据库迁移文件，文件名格式为 <版本号>_<名称>.sql，按版本号顺序执行，已发布的迁移不能再修改
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration 一个数据库迁移
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// 读取内嵌的迁移文件，按版本号排序
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations error: %v", err)
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base := strings.TrimSuffix(fileName, ".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("迁移文件名 %s 格式错误，应为 <版本号>_<名称>.sql", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("迁移文件名 %s 的版本号无效", fileName)
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("迁移文件 %s 与 %s 的版本号重复", fileName, other)
+		}
+		seen[version] = fileName
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s error: %v", fileName, err)
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// 读取已应用的迁移版本及应用时间
+func appliedMigrations(db dbExecutor) (map[int]string, error) {
+	exists, err := tableExists(db, "schema_version")
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]string)
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("query schema_version error: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close err: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema_version error: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("query schema_version error: %v", err)
+	}
+	return applied, nil
+}
+
+// 查找尚未应用的迁移
+func pendingMigrations(db dbExecutor) ([]migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// 迁移前备份数据库，VACUUM INTO 会写出包含 WAL 中数据的完整副本
+func backupDB(db *sql.DB) (string, error) {
+	backupPath := fmt.Sprintf("%s.%s.bak", dbFilePath, time.Now().Format("20060102-150405"))
+	_, err := db.Exec("VACUUM INTO ?", backupPath)
+	if err != nil {
+		return "", fmt.Errorf("backup database error: %v", err)
+	}
+	return backupPath, nil
+}
+
+// 按顺序执行所有未应用的迁移，每个迁移在单独的事务中执行，返回应用的迁移数量
+// 数据库中已有数据时先备份，迁移失败时可用备份恢复
+func migrateUp(db *sql.DB) (int, error) {
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	// 新建的空数据库无需备份
+	hasEvents, err := tableExists(db, "events")
+	if err != nil {
+		return 0, err
+	}
+	if hasEvents {
+		backupPath, err := backupDB(db)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("数据库迁移前已备份到 %s", backupPath)
+	}
+
+	store := newSQLiteStore(db)
+	for _, m := range pending {
+		err = store.withTx(func(tx *sqliteStore) error {
+			_, err := tx.db.Exec(`
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INTEGER NOT NULL PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			`)
+			if err != nil {
+				return fmt.Errorf("create schema_version error: %v", err)
+			}
+
+			// 迁移系统之前创建的数据库没有版本记录，先补齐旧版本自动添加的列，再执行初始迁移
+			if m.Version == 1 {
+				if err = upgradeLegacySchema(tx.db); err != nil {
+					return err
+				}
+			}
+
+			if _, err = tx.db.Exec(m.SQL); err != nil {
+				return fmt.Errorf("执行迁移 %04d_%s 失败: %v", m.Version, m.Name, err)
+			}
+			_, err = tx.db.Exec("INSERT INTO schema_version (version, name) VALUES (?, ?)", m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("record schema_version error: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("已应用数据库迁移 %04d_%s", m.Version, m.Name)
+	}
+	return len(pending), nil
+}
+
+// 输出每个迁移的应用状态
+func printMigrateStatus(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	current, pending := 0, 0
+	for _, m := range migrations {
+		if appliedAt, ok := applied[m.Version]; ok {
+			current = m.Version
+			fmt.Printf("  [已应用] %04d_%s  %s\n", m.Version, m.Name, appliedAt)
+		} else {
+			pending++
+			fmt.Printf("  [待应用] %04d_%s\n", m.Version, m.Name)
+		}
+	}
+	fmt.Printf("数据库 %s 当前版本: %d，待应用的迁移: %d\n", dbFilePath, current, pending)
+	return nil
+}
+
+// RunMigrateCommand 执行 migrate 子命令：status 查看迁移状态，up 备份数据库后应用所有未应用的迁移
+func RunMigrateCommand(args []string) error {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return fmt.Errorf("用法: migrate status|up")
+	}
+
+	db, err := connectDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("close db err: %v", err)
+		}
+	}()
+
+	if args[0] == "status" {
+		return printMigrateStatus(db)
+	}
+
+	applied, err := migrateUp(db)
+	if err != nil {
+		return err
+	}
+	if applied == 0 {
+		fmt.Println("数据库已是最新版本")
+		return nil
+	}
+	fmt.Printf("已应用 %d 个迁移\n", applied)
+	return printMigrateStatus(db)
+}
@@ -0,0 +1,79 @@
+-- 初始表结构。没有 schema_version 表的旧版本数据库在执行前会先补齐缺失的列
+
+-- 创建抽奖活动表
+CREATE TABLE IF NOT EXISTS events (
+	id TEXT PRIMARY KEY,
+	group_name TEXT,
+	prize_name TEXT,
+	prize_result_method TEXT,
+	prize_result TEXT,
+	how_to_participate TEXT,
+	participate TEXT,
+	key_word TEXT,
+	prizes_list TEXT,
+	time_of_winners TEXT,
+	all_prizes TEXT,
+	choose_prizes TEXT,
+	prize_count INTEGER,
+	number_of_winners INTEGER,
+	open_status BOOLEAN,
+	cancel_status BOOLEAN,
+	seed TEXT NOT NULL DEFAULT '',
+	seed_commitment TEXT NOT NULL DEFAULT '',
+	tiers TEXT NOT NULL DEFAULT '[]',
+	chat_id INTEGER NOT NULL DEFAULT 0,
+	announce_message_id INTEGER NOT NULL DEFAULT 0,
+	required_chats TEXT NOT NULL DEFAULT '[]'
+);
+
+-- 创建参与者表
+CREATE TABLE IF NOT EXISTS participants (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	user_name TEXT,
+	event_id TEXT,
+	joined_at DATETIME,
+	eligible BOOLEAN NOT NULL DEFAULT 1,
+	ineligible_reason TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+-- 创建中奖者表
+CREATE TABLE IF NOT EXISTS luckyUser (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	user_name TEXT,
+	prize_info TEXT,
+	event_id TEXT,
+	tier_index INTEGER NOT NULL DEFAULT 0,
+	tier_name TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+-- 创建奖品库存表
+CREATE TABLE IF NOT EXISTS prizes (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	text TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'available',
+	event_id TEXT,
+	pool TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+-- 创建创建活动向导状态表
+CREATE TABLE IF NOT EXISTS wizard_states (
+	user_id INTEGER NOT NULL PRIMARY KEY,
+	state TEXT NOT NULL,
+	event_info TEXT NOT NULL,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建管理员表
+CREATE TABLE IF NOT EXISTS admins (
+	user_id INTEGER NOT NULL PRIMARY KEY,
+	role TEXT NOT NULL,
+	added_by INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
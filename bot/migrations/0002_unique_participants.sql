@@ -0,0 +1,6 @@
+-- 同一用户在同一活动中只能参与一次
+-- 先删除并发参与时重复登记的记录，保留最早的一条
+DELETE FROM participants
+WHERE id NOT IN (SELECT MIN(id) FROM participants GROUP BY event_id, user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_participants_event_user ON participants (event_id, user_id);
@@ -0,0 +1,5 @@
+-- 最少参与人数规则：开奖时参与人数不足 min_participants（0 表示奖品数量）时的处理方式
+-- min_participants_action 为 cancel（取消活动，默认）、extend（延长开奖时间 extend_hours 小时）或 draw（照常开奖，中奖人数减少）
+ALTER TABLE events ADD COLUMN min_participants INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN min_participants_action TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN extend_hours INTEGER NOT NULL DEFAULT 0;
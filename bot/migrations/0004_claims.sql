@@ -0,0 +1,23 @@
+-- 中奖者领取奖品：设置了领取期限的活动，中奖者须在期限内点击领取，逾期未领取由候补依次递补
+ALTER TABLE events ADD COLUMN claim_hours INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN alternate_count INTEGER NOT NULL DEFAULT 0;
+
+-- claim_status 为空表示无需领取（旧版本或未设置领取期限的活动），pending 待领取，claimed 已领取，expired 逾期未领取
+ALTER TABLE luckyUser ADD COLUMN claim_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE luckyUser ADD COLUMN claim_deadline DATETIME;
+ALTER TABLE luckyUser ADD COLUMN claimed_at DATETIME;
+-- 递补中奖者的候补顺序，开奖时抽出的中奖者为 0
+ALTER TABLE luckyUser ADD COLUMN alternate_position INTEGER NOT NULL DEFAULT 0;
+
+-- 候补名单，开奖时按洗牌顺序接在中奖者之后抽出
+CREATE TABLE IF NOT EXISTS alternates (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	event_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	user_name TEXT NOT NULL DEFAULT '',
+	promoted BOOLEAN NOT NULL DEFAULT 0,
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alternates_event_position ON alternates (event_id, position);
@@ -0,0 +1,4 @@
+-- 中奖通知的送达状态：为空表示旧版本的记录，pending 待发送，delivered 已送达，failed 发送失败
+ALTER TABLE luckyUser ADD COLUMN delivery_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE luckyUser ADD COLUMN delivery_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE luckyUser ADD COLUMN delivered_at DATETIME;
@@ -0,0 +1,17 @@
+-- 邀请奖励：每邀请一位好友参与，邀请人增加一次抽奖机会，最多增加 referral_cap 次，0 表示不启用
+ALTER TABLE events ADD COLUMN referral_cap INTEGER NOT NULL DEFAULT 0;
+
+-- 参与者的邀请人，0 表示不是通过邀请链接参与
+ALTER TABLE participants ADD COLUMN referred_by INTEGER NOT NULL DEFAULT 0;
+
+-- 通过邀请链接启动机器人的记录，被邀请人之后参与活动时计入邀请人，同一用户只记录第一位邀请人
+CREATE TABLE IF NOT EXISTS referrals (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	event_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	referrer_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referrals_event_user ON referrals (event_id, user_id);
@@ -0,0 +1,26 @@
+-- 加权抽奖规则：活动期间在抽奖群中每发送 messages_per_entry 条消息增加一次抽奖机会，最多增加 message_entries_cap 次（0 表示不限）；
+-- 抽奖群管理员和 VIP 名单中的用户抽奖次数乘以 vip_multiplier（0 或 1 表示不启用）
+ALTER TABLE events ADD COLUMN messages_per_entry INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN message_entries_cap INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN vip_multiplier INTEGER NOT NULL DEFAULT 0;
+
+-- 开奖时每位参与者的抽奖次数，用于事后复算，0 表示开奖时未记录（未开奖或旧版本的活动）
+ALTER TABLE participants ADD COLUMN entries INTEGER NOT NULL DEFAULT 0;
+
+-- 活动期间每位用户在抽奖群中发送的消息数量
+CREATE TABLE IF NOT EXISTS event_messages (
+	event_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (event_id, user_id),
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
+
+-- 通过 CSV 导入的基础抽奖次数，未导入的用户为 1
+CREATE TABLE IF NOT EXISTS entry_weights (
+	event_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	weight INTEGER NOT NULL,
+	PRIMARY KEY (event_id, user_id),
+	FOREIGN KEY (event_id) REFERENCES events(id)
+);
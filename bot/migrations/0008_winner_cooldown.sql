@@ -0,0 +1,8 @@
+-- 中奖冷却规则：开奖时排除 cooldown_days 天内或最近 cooldown_events 场活动中中奖的用户，
+-- 以及本月中奖次数已达 monthly_win_cap 次的用户，0 表示不启用
+ALTER TABLE events ADD COLUMN cooldown_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN cooldown_events INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN monthly_win_cap INTEGER NOT NULL DEFAULT 0;
+
+-- 开奖时间（UTC），用于计算中奖冷却，旧版本开奖的活动为空
+ALTER TABLE events ADD COLUMN opened_at DATETIME;
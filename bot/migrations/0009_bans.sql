@@ -0,0 +1,12 @@
+-- 禁止参与的用户：event_id 为空表示禁止参与所有活动，expires_at 为空表示永久禁止
+CREATE TABLE IF NOT EXISTS bans (
+	id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	event_id TEXT NOT NULL DEFAULT '',
+	reason TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME,
+	banned_by INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bans_user_event ON bans (user_id, event_id);
@@ -2,42 +2,81 @@ package bot
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 )
 
-// 保存参与者信息到数据库
-func saveParticipant(db *sql.DB, eventID string, partner Partner) error {
-	stmt, err := db.Prepare("INSERT INTO participants(user_id, user_name, event_id) VALUES (?, ?, ?)")
-	if err != nil {
-		return fmt.Errorf("error preparing statement: %v", err)
-	}
-	defer func() {
-		if err := stmt.Close(); err != nil {
-			log.Printf("stmt.Close error: %v", err)
+// 登记活动参与者，返回是否为新参与以及登记后的参与人数
+// 两者在同一事务中完成，并发参与时每位参与者看到的人数各不相同；活动已开奖或取消时返回 errEventClosed
+func (s *sqliteStore) AddParticipant(eventID string, partner Partner) (added bool, count int, err error) {
+	err = s.withTx(func(tx *sqliteStore) error {
+		var open bool
+		err := tx.db.QueryRow("SELECT open_status = 0 AND cancel_status = 0 FROM events WHERE id = ?", eventID).Scan(&open)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("event id does not exist")
+			}
+			return fmt.Errorf("query event status error: %v", err)
+		}
+		if !open {
+			return fmt.Errorf("活动ID %v: %w", eventID, errEventClosed)
+		}
+
+		result, err := tx.db.Exec(`
+		INSERT INTO participants (user_id, user_name, event_id, joined_at)
+		VALUES (?, ?, ?, strftime('%Y-%m-%d %H:%M:%f', 'now'))
+		ON CONFLICT (event_id, user_id) DO NOTHING
+		`, partner.UserID, partner.UserName, eventID)
+		if err != nil {
+			return fmt.Errorf("error saving participant: %v", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error saving participant: %v", err)
+		}
+		added = affected == 1
+
+		// 通过邀请链接参与时记录邀请人，邀请人须已参与此活动
+		if added {
+			_, err = tx.db.Exec(`
+			UPDATE participants SET referred_by = IFNULL((
+				SELECT r.referrer_id FROM referrals r
+				INNER JOIN participants p ON p.event_id = r.event_id AND p.user_id = r.referrer_id
+				WHERE r.event_id = ? AND r.user_id = ?
+			), 0)
+			WHERE event_id = ? AND user_id = ?
+			`, eventID, partner.UserID, eventID, partner.UserID)
+			if err != nil {
+				return fmt.Errorf("error saving referrer: %v", err)
+			}
 		}
-	}()
 
-	_, err = stmt.Exec(partner.UserID, partner.UserName, eventID)
+		count, err = tx.CountParticipants(eventID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error saving participant: %v", err)
+		return false, 0, err
 	}
-
-	return nil
+	return added, count, nil
 }
 
-// 查找指定活动ID下的所有参与者
-func getParticipantsByEventID(db *sql.DB, eventID string) ([]Partner, error) {
+// 邀请人数只计算具备资格的被邀请人，被邀请人失去资格时邀请奖励也随之失效
+const referralCountColumn = `(SELECT COUNT(*) FROM participants r
+	WHERE r.event_id = participants.event_id AND r.referred_by = participants.user_id AND r.eligible = 1)`
+
+// 查找指定活动ID下所有具备资格的参与者及其邀请人数，按参与时间排序
+func (s *sqliteStore) ListParticipants(eventID string) ([]Partner, error) {
 	query := `
-	SELECT user_id, user_name 
-	FROM participants 
-	WHERE event_id = ?;
+	SELECT user_id, user_name, ` + referralCountColumn + `, entries
+	FROM participants
+	WHERE event_id = ? AND eligible = 1
+	ORDER BY joined_at, id;
 	`
 
-	rows, err := db.Query(query, eventID)
+	rows, err := s.db.Query(query, eventID)
 	if err != nil {
-		return nil, fmt.Errorf("getParticipantsByEventID: %w", err)
+		return nil, fmt.Errorf("ListParticipants: %w", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -48,107 +87,83 @@ func getParticipantsByEventID(db *sql.DB, eventID string) ([]Partner, error) {
 	var participants []Partner
 	for rows.Next() {
 		var partner Partner
-		err := rows.Scan(&partner.UserID, &partner.UserName)
+		err := rows.Scan(&partner.UserID, &partner.UserName, &partner.Referrals, &partner.Entries)
 		if err != nil {
-			return nil, fmt.Errorf("getParticipantsByEventID: %w", err)
+			return nil, fmt.Errorf("ListParticipants: %w", err)
 		}
 		participants = append(participants, partner)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("getParticipantsByEventID: %w", err)
+		return nil, fmt.Errorf("ListParticipants: %w", err)
 	}
 
 	return participants, nil
 }
 
-// GetUserEventsByUserID 通过用户ID获取此用户参与过的所有活动信息
-func GetUserEventsByUserID(db *sql.DB, userID int64) ([]EventInformation, error) {
-	// 准备查询语句，获取用户参与的活动ID
+// 查询用户在活动中的参与记录，未参与时 ok 为 false
+func (s *sqliteStore) GetParticipation(eventID string, userID int64) (p Participation, ok bool, err error) {
 	query := `
-		SELECT events.id, events.group_name, events.prize_name, events.prize_result_method, events.prize_result,
-		       events.how_to_participate, events.participate, events.key_word, events.prizes_list, events.time_of_winners,
-		       events.all_prizes, events.choose_prizes, events.prize_count, events.number_of_winners, 
-		       events.open_status, events.cancel_status
+	SELECT IFNULL(joined_at, ''), eligible, ineligible_reason, position, referrals, entries
+	FROM (
+		SELECT id, user_id, joined_at, eligible, ineligible_reason, entries,
+		       ROW_NUMBER() OVER (ORDER BY joined_at, id) AS position,
+		       ` + referralCountColumn + ` AS referrals
 		FROM participants
-		INNER JOIN events ON participants.event_id = events.id
-		WHERE participants.user_id = ?
+		WHERE event_id = ?
+	)
+	WHERE user_id = ?
+	ORDER BY id
+	LIMIT 1;
 	`
 
-	// 执行查询
-	rows, err := db.Query(query, userID)
+	err = s.db.QueryRow(query, eventID, userID).Scan(&p.JoinedAt, &p.Eligible, &p.IneligibleReason, &p.Position, &p.Referrals, &p.Entries)
 	if err != nil {
-		log.Printf("Error executing query to retrieve events for user %d: %v", userID, err)
-		return nil, fmt.Errorf("error executing query to retrieve events for user %d: %v", userID, err)
-	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			log.Printf("rows.Close err: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Participation{}, false, nil
 		}
-	}()
-
-	var events []EventInformation
-
-	// 解析查询结果
-	for rows.Next() {
-		var event EventInformation
-		var allPrizes, choosePrizes string
-
-		err := rows.Scan(&event.ID, &event.GroupName, &event.PrizeName, &event.PrizeResultMethod, &event.PrizeResult,
-			&event.HowToParticipate, &event.Participate, &event.KeyWord, &event.PrizesList, &event.TimeOfWinners,
-			&allPrizes, &choosePrizes, &event.PrizeCount, &event.NumberOfWinners, &event.OpenStatus, &event.CancelStatus)
-		if err != nil {
-			log.Printf("Error scanning event data for user %d: %v", userID, err)
-			return nil, fmt.Errorf("error scanning event data for user %d: %v", userID, err)
-		}
-
-		// Convert the string representations of the allPrizes and choosePrizes fields back to slices
-		event.AllPrizes = strings.Split(allPrizes, ",")
-		event.ChoosePrizes = strings.Split(choosePrizes, ",")
-
-		events = append(events, event)
+		return Participation{}, false, fmt.Errorf("GetParticipation ERROR: %v", err)
 	}
+	return p, true, nil
+}
 
-	if err = rows.Err(); err != nil {
-		log.Printf("Error encountered during rows iteration for user %d: %v", userID, err)
-		return nil, fmt.Errorf("error encountered during rows iteration for user %d: %v", userID, err)
+// 取消参与者的抽奖资格并记录原因
+func (s *sqliteStore) MarkParticipantIneligible(eventID string, userID int64, reason string) error {
+	_, err := s.db.Exec("UPDATE participants SET eligible = 0, ineligible_reason = ? WHERE event_id = ? AND user_id = ?",
+		reason, eventID, userID)
+	if err != nil {
+		return fmt.Errorf("MarkParticipantIneligible ERROR: %v", err)
 	}
-
-	return events, nil
+	return nil
 }
 
-// 检查用户是否已经参与过该活动
-func hasParticipated(db *sql.DB, eventID string, userID int64) (bool, error) {
-	stmt, err := db.Prepare("SELECT COUNT(*) FROM participants WHERE event_id = ? AND user_id = ?")
+// 记录用户通过邀请链接启动机器人，同一活动中只记录第一位邀请人，已记录时返回 false
+func (s *sqliteStore) SaveReferral(eventID string, userID int64, referrerID int64) (bool, error) {
+	result, err := s.db.Exec(`
+	INSERT INTO referrals (event_id, user_id, referrer_id) VALUES (?, ?, ?)
+	ON CONFLICT (event_id, user_id) DO NOTHING
+	`, eventID, userID, referrerID)
 	if err != nil {
-		return false, fmt.Errorf("error preparing statement: %w", err)
+		return false, fmt.Errorf("SaveReferral ERROR: %v", err)
 	}
-	defer func() {
-		if err := stmt.Close(); err != nil {
-			log.Printf("stmt.Close error: %v", err)
-		}
-	}()
-
-	var count int
-	err = stmt.QueryRow(eventID, userID).Scan(&count)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return false, fmt.Errorf("error scanning participated event for user %d: %v", userID, err)
+		return false, fmt.Errorf("SaveReferral ERROR: %v", err)
 	}
-
-	return count > 0, nil
+	return affected == 1, nil
 }
 
 // 查询给定活动ID下的参与者数量
-func getParticipantCountByEventID(db *sql.DB, eventID string) (count int, err error) {
+func (s *sqliteStore) CountParticipants(eventID string) (count int, err error) {
 	query := `
-	SELECT COUNT(*) 
-	FROM participants 
+	SELECT COUNT(*)
+	FROM participants
 	WHERE event_id = ?;
 	`
 
-	err = db.QueryRow(query, eventID).Scan(&count)
+	err = s.db.QueryRow(query, eventID).Scan(&count)
 	if err != nil {
-		return 0, fmt.Errorf("getParticipantCountByEventID ERROR: %v", err)
+		return 0, fmt.Errorf("CountParticipants ERROR: %v", err)
 	}
 
 	return count, nil
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// 加载库存中可用的奖品列表，按添加顺序排列
+func (s *sqliteStore) ListAvailablePrizes() ([]Prize, error) {
+	rows, err := s.db.Query(`
+	SELECT id, text, status, IFNULL(event_id, ''), pool, created_at, updated_at
+	FROM prizes
+	WHERE status = ?
+	ORDER BY id;
+	`, prizeStatusAvailable)
+	if err != nil {
+		return nil, fmt.Errorf("loadPrizes ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close ERROR: %v", err)
+		}
+	}()
+
+	var prizes []Prize
+	for rows.Next() {
+		var prize Prize
+		err = rows.Scan(&prize.ID, &prize.Text, &prize.Status, &prize.EventID, &prize.Pool, &prize.CreatedAt, &prize.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan prizes ERROR: %v", err)
+		}
+		prizes = append(prizes, prize)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("loadPrizes ERROR: %v", err)
+	}
+
+	return prizes, nil
+}
+
+// 取出奖品的文本内容
+func prizeTexts(prizes []Prize) []string {
+	texts := make([]string, 0, len(prizes))
+	for _, prize := range prizes {
+		texts = append(texts, prize.Text)
+	}
+	return texts
+}
+
+// 添加奖品到库存的指定奖池
+func (s *sqliteStore) AddPrizes(pool string, prizes []string) error {
+	return s.withTx(func(tx *sqliteStore) error {
+		return tx.insertPrizes(pool, prizes)
+	})
+}
+
+func (s *sqliteStore) insertPrizes(pool string, prizes []string) error {
+	stmt, err := s.db.Prepare("INSERT INTO prizes (text, status, pool) VALUES (?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("error preparing statement: %v", err)
+	}
+	defer func() {
+		if err := stmt.Close(); err != nil {
+			log.Printf("stmt.Close error: %v", err)
+		}
+	}()
+
+	for _, prize := range prizes {
+		_, err = stmt.Exec(prize, prizeStatusAvailable, pool)
+		if err != nil {
+			return fmt.Errorf("error saving prize: %v", err)
+		}
+	}
+	return nil
+}
+
+// 从库存的指定奖池删除奖品，每个传入的奖品只删除一条库存记录，返回未找到的奖品
+func (s *sqliteStore) RemovePrizes(pool string, prizes []string) (notFound []string, err error) {
+	err = s.withTx(func(tx *sqliteStore) error {
+		for _, prize := range prizes {
+			result, err := tx.db.Exec(`
+			DELETE FROM prizes
+			WHERE id = (SELECT id FROM prizes WHERE text = ? AND pool = ? AND status = ? ORDER BY id LIMIT 1);
+			`, prize, pool, prizeStatusAvailable)
+			if err != nil {
+				return fmt.Errorf("error deleting prize: %v", err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error deleting prize: %v", err)
+			}
+			if affected == 0 {
+				notFound = append(notFound, prize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return notFound, nil
+}
+
+// 从各奖项的奖池中为活动预留奖品，任意一个奖品已不在库存中则返回错误
+func (s *sqliteStore) ReservePrizes(eventID string, tiers []PrizeTier) error {
+	for _, tier := range tiers {
+		for _, prize := range tier.Prizes {
+			result, err := s.db.Exec(`
+			UPDATE prizes SET status = ?, event_id = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = (SELECT id FROM prizes WHERE text = ? AND pool = ? AND status = ? ORDER BY id LIMIT 1);
+			`, prizeStatusReserved, eventID, prize, tier.Pool, prizeStatusAvailable)
+			if err != nil {
+				return fmt.Errorf("error reserving prize: %v", err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error reserving prize: %v", err)
+			}
+			if affected == 0 {
+				return fmt.Errorf("奖品 %s 已不在库存中，请重新创建活动", prize)
+			}
+		}
+	}
+	return nil
+}
+
+// 将已发放但无人领取的奖品退回库存
+func (s *sqliteStore) UnawardPrize(eventID string, prize string) error {
+	result, err := s.db.Exec(`
+	UPDATE prizes SET status = ?, event_id = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE id = (SELECT id FROM prizes WHERE event_id = ? AND text = ? AND status = ? ORDER BY id LIMIT 1);
+	`, prizeStatusAvailable, eventID, prize, prizeStatusAwarded)
+	if err != nil {
+		return fmt.Errorf("error unawarding prize: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error unawarding prize: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("活动 %s 没有已发放的奖品 %s", eventID, prize)
+	}
+	return nil
+}
+
+// 将活动预留但未发放的奖品退回库存，返回退回的奖品数量
+func (s *sqliteStore) ReleasePrizes(eventID string) (int, error) {
+	result, err := s.db.Exec(`
+	UPDATE prizes SET status = ?, event_id = NULL, updated_at = CURRENT_TIMESTAMP
+	WHERE event_id = ? AND status = ?;
+	`, prizeStatusAvailable, eventID, prizeStatusReserved)
+	if err != nil {
+		return 0, fmt.Errorf("error releasing prizes: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error releasing prizes: %v", err)
+	}
+	return int(affected), nil
+}
+
+// 将活动预留的奖品标记为已发放
+func (s *sqliteStore) AwardPrize(eventID string, prize string) error {
+	result, err := s.db.Exec(`
+	UPDATE prizes SET status = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = (SELECT id FROM prizes WHERE event_id = ? AND text = ? AND status = ? ORDER BY id LIMIT 1);
+	`, prizeStatusAwarded, eventID, prize, prizeStatusReserved)
+	if err != nil {
+		return fmt.Errorf("error awarding prize: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error awarding prize: %v", err)
+	}
+	if affected == 0 {
+		// 旧版本创建的活动没有预留记录，奖品早已从奖品文件中移除
+		log.Printf("活动ID %s 没有预留奖品 %s 的记录", eventID, prize)
+	}
+	return nil
+}
+
+// 将旧版本奖品文件中的奖品一次性导入数据库，导入后文件被重命名，避免重复导入
+func importPrizesFromTxtFile(store Store) error {
+	if config.PrizeTxtFilePath == "" {
+		return nil
+	}
+	file, err := os.Open(config.PrizeTxtFilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("open file error: %v", err)
+	}
+
+	var prizes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			prizes = append(prizes, line)
+		}
+	}
+	if err := file.Close(); err != nil {
+		log.Printf("prizes file close error: %v", err)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanning file error: %v", err)
+	}
+
+	// 文件在事务提交前重命名，提交失败时恢复原文件名
+	importedPath := config.PrizeTxtFilePath + ".imported"
+	renamed := false
+	err = store.WithTx(func(tx Store) error {
+		err := tx.AddPrizes("", prizes)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(config.PrizeTxtFilePath, importedPath); err != nil {
+			return fmt.Errorf("rename prizes file error: %v", err)
+		}
+		renamed = true
+		return nil
+	})
+	if err != nil {
+		if renamed {
+			if err := os.Rename(importedPath, config.PrizeTxtFilePath); err != nil {
+				log.Printf("restore prizes file error: %v", err)
+			}
+		}
+		return err
+	}
+
+	log.Printf("已从 %s 导入 %d 个奖品，原文件已重命名为 %s", config.PrizeTxtFilePath, len(prizes), importedPath)
+	return nil
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// 邀请获得的额外抽奖次数：每邀请一位好友参与增加一次，最多增加 ReferralCap 次
+func referralBonus(info EventInformation, referrals int) int {
+	return min(referrals, info.ReferralCap)
+}
+
+// 参与者的邀请链接，好友通过此链接启动机器人后参与活动即计入邀请人数
+func (b *Bot) referralLink(eventID string, userID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=ref_%s_%d", b.Bot.Self.UserName, eventID, userID)
+}
+
+// 生成邀请奖励的说明，未启用邀请奖励的活动不显示
+func formatReferralRuleHTML(info EventInformation) string {
+	if info.ReferralCap <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("<b>邀请奖励：</b> 每邀请一位好友参与增加一次抽奖机会，最多增加 %d 次，参与后私聊机器人发送 /see 查看邀请链接\n",
+		info.ReferralCap)
+}
+
+// 解析邀请链接的参数 <活动ID>_<邀请人ID>
+func parseReferralPayload(payload string) (eventID string, referrerID int64, err error) {
+	eventID, referrerStr, ok := strings.Cut(payload, "_")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid referral payload: %s", payload)
+	}
+	referrerID, err = strconv.ParseInt(referrerStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid referrer id: %s", referrerStr)
+	}
+	return eventID, referrerID, nil
+}
+
+// 用户通过 start=ref_<活动ID>_<邀请人ID> 启动机器人时记录邀请人，
+// 私聊参与的活动直接参与，群组内参与的活动提示用户到抽奖群中参与
+func (b *Bot) startReferral(msg *tgbotapi.Message, payload string) error {
+	if !msg.Chat.IsPrivate() {
+		return b.sendReply(msg, "请在私聊中发送")
+	}
+	eventID, referrerID, err := parseReferralPayload(payload)
+	if err != nil {
+		log.Printf("parseReferralPayload: %v", err)
+		return b.sendReply(msg, "邀请链接无效")
+	}
+	info, err := b.store.GetEvent(eventID)
+	if err != nil {
+		log.Printf("GetEvent: %v", err)
+		return b.sendReply(msg, "活动不存在: "+eventID)
+	}
+	if info.OpenStatus || info.CancelStatus {
+		return b.sendReply(msg, "活动已结束: "+info.ID)
+	}
+
+	// 自己的邀请链接不计入邀请人数
+	if info.ReferralCap > 0 && referrerID != msg.From.ID {
+		_, err = b.store.SaveReferral(info.ID, msg.From.ID, referrerID)
+		if err != nil {
+			log.Printf("SaveReferral: %v", err)
+		}
+	}
+
+	if info.HowToParticipate == "2" {
+		return b.startJoin(msg, info.ID)
+	}
+	return b.sendReply(msg, fmt.Sprintf("请在抽奖群 %s 中发送 /join %s 或点击活动公告下方的按钮参与活动", info.GroupName, info.KeyWord))
+}
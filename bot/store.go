@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// EventStore 活动信息的存取
+type EventStore interface {
+	SaveEvent(info EventInformation) error
+	CreateEvent(info EventInformation) error // 保存新建的活动并从库存中预留其选中的奖品
+	GetEvent(id string) (EventInformation, error)
+	ListEvents() ([]EventInformation, error)
+	ListOngoingEvents() ([]EventInformation, error)               // 未开奖且未取消的活动
+	ListMessageCountingEvents(chatIDs ...int64) ([]string, error) // 属于指定群组、按发言数量增加抽奖次数的进行中活动ID
+	ListCanceledEvents() ([]EventInformation, error)
+	ListEventsByParticipant(userID int64) ([]EventInformation, error)
+	MarkEventOpened(id string) (bool, error)
+	MarkEventCanceled(id string) (bool, error)
+	SetAnnounceMessageID(id string, messageID int) error
+}
+
+// ParticipantStore 活动参与者的存取
+type ParticipantStore interface {
+	AddParticipant(eventID string, partner Partner) (added bool, count int, err error)
+	CountParticipants(eventID string) (int, error)
+	ListParticipants(eventID string) ([]Partner, error) // 具备资格的参与者及其邀请人数和开奖时记录的抽奖次数，按参与时间排序
+	GetParticipation(eventID string, userID int64) (p Participation, ok bool, err error)
+	MarkParticipantIneligible(eventID string, userID int64, reason string) error
+	SaveReferral(eventID string, userID int64, referrerID int64) (bool, error)
+	SaveEntries(eventID string, partners []Partner) error // 开奖时记录每位参与者的抽奖次数
+	IncrementMessageCount(eventID string, userID int64) error
+	ListMessageCounts(eventID string) (map[int64]int, error)
+	ReplaceEntryWeights(eventID string, weights map[int64]int) error
+	ListEntryWeights(eventID string) (map[int64]int, error)
+}
+
+// WinnerStore 中奖记录的存取
+type WinnerStore interface {
+	SaveWinner(eventID string, luckyUser LuckyUser) (int64, error)
+	ListWinners(eventID string) ([]LuckyUser, error)       // 当前的中奖者，不含逾期未领取的
+	ListWinnerRecords(eventID string) ([]LuckyUser, error) // 全部中奖记录，用于复算
+	ListWinsByUser(userID int64) ([]winInfo, error)
+	CountWinsSince(since string) (map[int64]int, error)   // 开奖时间不早于 since（UTC）的活动中每位用户的中奖次数
+	CountWinsInRecentEvents(n int) (map[int64]int, error) // 最近 n 场已开奖的活动中每位用户的中奖次数
+	GetWinner(id int64) (LuckyUser, error)
+	ClaimPrize(id int64, userID int64) (bool, error)
+	ListExpiredClaims() ([]LuckyUser, error)
+	ExpireClaim(id int64) (bool, error)
+	SetDeliveryStatus(id int64, status string, reason string) error
+	ListUndelivered() ([]LuckyUser, error) // 中奖通知待发送或发送失败的记录
+	SaveAlternates(eventID string, partners []Partner) error
+	NextAlternate(eventID string) (alternate Alternate, ok bool, err error)
+	ListAlternates(eventID string) ([]Alternate, error)
+}
+
+// PrizeStore 奖品库存的存取
+type PrizeStore interface {
+	ListAvailablePrizes() ([]Prize, error)
+	AddPrizes(pool string, prizes []string) error
+	RemovePrizes(pool string, prizes []string) (notFound []string, err error)
+	ReservePrizes(eventID string, tiers []PrizeTier) error
+	AwardPrize(eventID string, prize string) error
+	ReleasePrizes(eventID string) (int, error)
+	UnawardPrize(eventID string, prize string) error
+}
+
+// WizardStore 创建活动向导状态的存取
+type WizardStore interface {
+	SaveWizardState(userID int64, state string, info EventInformation) error
+	DeleteWizardState(userID int64) error
+	LoadWizardStates() (states map[int64]string, infos map[int64]EventInformation, err error)
+}
+
+// AdminStore 管理员的存取
+type AdminStore interface {
+	GetAdminRole(userID int64) (role string, ok bool, err error)
+	SaveAdmin(userID int64, role string, addedBy int64) error
+	DeleteAdmin(userID int64) (bool, error)
+	ListAdmins() ([]Admin, error)
+}
+
+// BanStore 禁止参与的用户，已到期的记录不再生效
+type BanStore interface {
+	SaveBan(ban Ban) error
+	DeleteBan(userID int64, eventID string) (bool, error)
+	GetActiveBan(userID int64, eventID string) (ban Ban, ok bool, err error) // 对指定活动生效的记录，包括禁止参与所有活动的记录
+	ListActiveBans() ([]Ban, error)
+	ListBannedUsers(eventID string) (map[int64]bool, error)
+}
+
+// Store 机器人使用的全部数据存取，可替换为其他实现或在测试中模拟
+type Store interface {
+	EventStore
+	ParticipantStore
+	WinnerStore
+	PrizeStore
+	WizardStore
+	AdminStore
+	BanStore
+
+	// WithTx 在同一事务中执行 fn，fn 返回错误时回滚
+	WithTx(fn func(tx Store) error) error
+	Close() error
+}
+
+// sqliteStore 基于 SQLite 的 Store 实现，db 为连接池或事务
+type sqliteStore struct {
+	db   dbExecutor
+	conn *sql.DB // 连接池，在事务中也保留，用于关闭
+}
+
+func newSQLiteStore(db *sql.DB) *sqliteStore {
+	return &sqliteStore{db: db, conn: db}
+}
+
+func (s *sqliteStore) WithTx(fn func(tx Store) error) error {
+	return s.withTx(func(tx *sqliteStore) error {
+		return fn(tx)
+	})
+}
+
+// 在事务中执行 fn，已处于事务中时直接使用当前事务
+func (s *sqliteStore) withTx(fn func(tx *sqliteStore) error) error {
+	if _, inTx := s.db.(*sql.Tx); inTx {
+		return fn(s)
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction error: %v", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("rollback error: %v", err)
+		}
+	}()
+
+	err = fn(&sqliteStore{db: tx, conn: s.conn})
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction error: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+)
+
+// 解析奖项设置，格式为 名称:数量[:奖池]，多个奖项用英文逗号分割，例如 一等奖:1:大奖,二等奖:3,参与奖:10
+func parseTiers(spec string) ([]PrizeTier, error) {
+	var tiers []PrizeTier
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("奖项格式错误: %s，应为 名称:数量[:奖池]", item)
+		}
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			return nil, fmt.Errorf("奖项名称不能为空: %s", item)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("奖项 %s 的数量必须是正整数", name)
+		}
+		tier := PrizeTier{Name: name, Count: count}
+		if len(parts) == 3 {
+			tier.Pool = strings.TrimSpace(parts[2])
+		}
+		tiers = append(tiers, tier)
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("没有有效的奖项")
+	}
+	return tiers, nil
+}
+
+// 活动的奖项设置，旧版本活动没有奖项设置时视为一个未命名的奖项
+func eventTiers(info EventInformation) []PrizeTier {
+	if len(info.Tiers) > 0 {
+		return info.Tiers
+	}
+	return []PrizeTier{{Count: info.PrizeCount, Prizes: info.ChoosePrizes}}
+}
+
+// 奖项的奖品数量之和
+func tiersPrizeCount(tiers []PrizeTier) int {
+	count := 0
+	for _, tier := range tiers {
+		count += tier.Count
+	}
+	return count
+}
+
+// 按奖项顺序从各自的奖池中挑选奖品，同一奖池中的奖品不会被重复选中
+func choosePrizesForTiers(prizes []Prize, tiers []PrizeTier) error {
+	used := make(map[int64]bool)
+	for i := range tiers {
+		if tiers[i].Count < 1 {
+			return fmt.Errorf("%s 的数量必须是正整数", tierDisplayName(tiers[i]))
+		}
+		tiers[i].Prizes = nil
+		for _, prize := range prizes {
+			if len(tiers[i].Prizes) == tiers[i].Count {
+				break
+			}
+			if prize.Pool != tiers[i].Pool || used[prize.ID] {
+				continue
+			}
+			used[prize.ID] = true
+			tiers[i].Prizes = append(tiers[i].Prizes, prize.Text)
+		}
+		if len(tiers[i].Prizes) < tiers[i].Count {
+			return fmt.Errorf("奖池 %s 中的奖品不足，%s 需要 %d 个，仅剩 %d 个",
+				poolDisplayName(tiers[i].Pool), tierDisplayName(tiers[i]), tiers[i].Count, len(tiers[i].Prizes))
+		}
+	}
+	return nil
+}
+
+// 按奖项顺序展开的全部奖品
+func tiersPrizes(tiers []PrizeTier) []string {
+	var prizes []string
+	for _, tier := range tiers {
+		prizes = append(prizes, tier.Prizes...)
+	}
+	return prizes
+}
+
+// 是否设置了命名的奖项
+func hasNamedTiers(tiers []PrizeTier) bool {
+	for _, tier := range tiers {
+		if tier.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func tierDisplayName(tier PrizeTier) string {
+	if tier.Name == "" {
+		return "奖品"
+	}
+	return tier.Name
+}
+
+func poolDisplayName(pool string) string {
+	if pool == "" {
+		return "默认奖池"
+	}
+	return pool
+}
+
+// 生成奖品列表字符串，设置了奖项时按奖项分组
+func formatTierPrizesList(tiers []PrizeTier) string {
+	if !hasNamedTiers(tiers) {
+		return strings.Join(tiersPrizes(tiers), "\n")
+	}
+	var lines []string
+	for _, tier := range tiers {
+		lines = append(lines, fmt.Sprintf("【%s】", tier.Name))
+		lines = append(lines, tier.Prizes...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 生成奖项设置的 HTML 描述，例如 一等奖 × 1，未设置奖项时返回空字符串
+func formatTiersHTML(tiers []PrizeTier) string {
+	if !hasNamedTiers(tiers) {
+		return ""
+	}
+	var lines []string
+	for _, tier := range tiers {
+		lines = append(lines, fmt.Sprintf("%s × %d", tgbotapi.EscapeText(tgbotapi.ModeHTML, tierDisplayName(tier)), tier.Count))
+	}
+	return "<b>奖项设置：</b>\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// 解析 /add、/delete 参数开头可选的 #奖池，返回奖池名称和剩余参数
+func parsePoolPrefix(args string) (pool string, rest string) {
+	if !strings.HasPrefix(args, "#") {
+		return "", args
+	}
+	fields := strings.SplitN(args, " ", 2)
+	pool = strings.TrimPrefix(fields[0], "#")
+	if len(fields) == 2 {
+		rest = strings.TrimSpace(fields[1])
+	}
+	return pool, rest
+}
@@ -11,45 +11,180 @@ var config Config
 
 // Config 配置文件
 type Config struct {
-	ApiToken         string `yaml:"api_token"`
-	AdminUserID      int64  `yaml:"admin_user_id"`
-	GroupUserName    string `yaml:"group_user_name"`
-	PrizeTxtFilePath string `yaml:"prize_txt_file_path"`
-	TimeZone         string `yaml:"timezone"`
+	ApiToken         string         `yaml:"api_token"`
+	AdminUserID      int64          `yaml:"admin_user_id"`
+	GroupUserName    string         `yaml:"group_user_name"` // 默认抽奖群，旧版本创建的活动都属于此群组
+	Groups           []string       `yaml:"groups"`          // 抽奖群列表，填写群组用户名或会话ID
+	PrizeTxtFilePath string         `yaml:"prize_txt_file_path"`
+	TimeZone         string         `yaml:"timezone"`
+	TrustGroupAdmins bool           `yaml:"trust_group_admins"` // 是否信任抽奖群的 Telegram 管理员
+	VIPUserIDs       []int64        `yaml:"vip_user_ids"`       // VIP 名单，设置了 VIP 倍数的活动中抽奖次数加倍
+	GroupAdminRole   string         `yaml:"group_admin_role"`   // 信任的群管理员拥有的角色，默认为活动管理员
+	APIEndpoint      string         `yaml:"api_endpoint"`       // Bot API 地址，格式同 tgbotapi.APIEndpoint，默认为官方地址
+	WinnerCooldown   CooldownConfig `yaml:"winner_cooldown"`    // 新建活动默认的中奖冷却规则，创建时可以单独设置
+	Webhook          WebhookConfig  `yaml:"webhook"`
+}
+
+// CooldownConfig 中奖冷却规则
+type CooldownConfig struct {
+	Days       int `yaml:"days"`        // 排除多少天内中过奖的用户
+	Events     int `yaml:"events"`      // 排除在最近多少场活动中中过奖的用户
+	MonthlyCap int `yaml:"monthly_cap"` // 每位用户每月最多中奖次数
+}
+
+// WebhookConfig webhook 模式配置
+type WebhookConfig struct {
+	Enabled     bool   `yaml:"enabled"`      // 是否使用 webhook 接收更新，关闭时使用长轮询
+	URL         string `yaml:"url"`          // Telegram 推送更新的公网地址，包含路径
+	Listen      string `yaml:"listen"`       // 内置 HTTP 服务的监听地址，例如 127.0.0.1:8080
+	Path        string `yaml:"path"`         // 内置 HTTP 服务接收更新的路径
+	SecretToken string `yaml:"secret_token"` // 校验请求头 X-Telegram-Bot-Api-Secret-Token 的密钥
 }
 
 // EventInformation 活动信息
 type EventInformation struct {
-	ID                string   `json:"id"`                //活动ID
-	GroupName         string   `json:"groupName"`         //群组名称
-	PrizeName         string   `json:"prizeName"`         //活动名称
-	PrizeResultMethod string   `json:"prizeResultMethod"` //选择开奖方式
-	PrizeResult       string   `json:"prizeResult"`       //开奖方式
-	HowToParticipate  string   `json:"howToParticipate"`  //选择参与方式
-	Participate       string   `json:"participate"`       //参与方式
-	KeyWord           string   `json:"keyWord"`           //抽奖关键词
-	PrizesList        string   `json:"prizesList"`        //返回奖品列表组成的字符串
-	TimeOfWinners     string   `json:"timeOfWinners"`     //开奖时间
-	AllPrizes         []string `json:"allPrizes"`         //全部奖品
-	ChoosePrizes      []string `json:"choosePrizes"`      //选中的奖品
-	PrizeCount        int      `json:"prizeCount"`        //奖品数量
-	NumberOfWinners   int      `json:"numberOfWinners"`   //开奖人数
-	OpenStatus        bool     `json:"openStatus"`        //开奖状态
-	CancelStatus      bool     `json:"cancelStatus"`      //是否为取消的活动
+	ID                string         `json:"id"`                //活动ID
+	GroupName         string         `json:"groupName"`         //群组名称
+	PrizeName         string         `json:"prizeName"`         //活动名称
+	PrizeResultMethod string         `json:"prizeResultMethod"` //选择开奖方式
+	PrizeResult       string         `json:"prizeResult"`       //开奖方式
+	HowToParticipate  string         `json:"howToParticipate"`  //选择参与方式
+	Participate       string         `json:"participate"`       //参与方式
+	KeyWord           string         `json:"keyWord"`           //抽奖关键词
+	PrizesList        string         `json:"prizesList"`        //返回奖品列表组成的字符串
+	TimeOfWinners     string         `json:"timeOfWinners"`     //开奖时间
+	AllPrizes         []string       `json:"allPrizes"`         //全部奖品
+	ChoosePrizes      []string       `json:"choosePrizes"`      //选中的奖品
+	PrizeCount        int            `json:"prizeCount"`        //奖品数量
+	NumberOfWinners   int            `json:"numberOfWinners"`   //开奖人数
+	OpenStatus        bool           `json:"openStatus"`        //开奖状态
+	CancelStatus      bool           `json:"cancelStatus"`      //是否为取消的活动
+	Seed              string         `json:"seed"`              //开奖种子，开奖前保密
+	SeedCommitment    string         `json:"seedCommitment"`    //开奖种子的SHA256承诺，创建时公布
+	Tiers             []PrizeTier    `json:"tiers"`             //奖项设置，按顺序开奖
+	ChatID            int64          `json:"chatId"`            //抽奖群的会话ID，旧版本活动为0，表示默认群组
+	AnnounceMessageID int            `json:"announceMessageId"` //群组中活动公告消息的ID，用于更新公告
+	RequiredChats     []RequiredChat `json:"requiredChats"`     //参与者必须加入的频道或群组
+	MinParticipants   int            `json:"minParticipants"`   //最少参与人数，0 表示与奖品数量相同
+	MinAction         string         `json:"minAction"`         //开奖时参与人数不足的处理方式，空表示取消活动
+	ExtendHours       int            `json:"extendHours"`       //人数不足时延长开奖时间的小时数
+	ClaimHours        int            `json:"claimHours"`        //中奖者领取奖品的期限（小时），0 表示无需领取
+	AlternateCount    int            `json:"alternateCount"`    //候补人数，中奖者逾期未领取时依次递补
+	ReferralCap       int            `json:"referralCap"`       //通过邀请获得的额外抽奖次数上限，0 表示不启用邀请奖励
+	MessagesPerEntry  int            `json:"messagesPerEntry"`  //在抽奖群中每发送多少条消息增加一次抽奖机会，0 表示不启用
+	MessageEntriesCap int            `json:"messageEntriesCap"` //通过发送消息获得的额外抽奖次数上限，0 表示不限
+	VIPMultiplier     int            `json:"vipMultiplier"`     //抽奖群管理员和 VIP 名单中的用户的抽奖次数倍数，0 或 1 表示不启用
+	CooldownDays      int            `json:"cooldownDays"`      //开奖时排除多少天内中过奖的用户，0 表示不启用
+	CooldownEvents    int            `json:"cooldownEvents"`    //开奖时排除在最近多少场已开奖活动中中过奖的用户，0 表示不启用
+	MonthlyWinCap     int            `json:"monthlyWinCap"`     //每位用户每月最多中奖次数，0 表示不限
+}
+
+// RequiredChat 参与活动必须加入的频道或群组
+type RequiredChat struct {
+	ID       int64  `json:"id"`       //会话ID
+	Title    string `json:"title"`    //频道或群组名称
+	UserName string `json:"userName"` //频道或群组的用户名，私有频道为空
+}
+
+// PrizeTier 奖项
+type PrizeTier struct {
+	Name   string   `json:"name"`   //奖项名称
+	Count  int      `json:"count"`  //中奖人数
+	Pool   string   `json:"pool"`   //奖品所属奖池
+	Prizes []string `json:"prizes"` //本奖项的奖品
 }
 
 // Partner 参与者
 type Partner struct {
-	UserID   int64  `json:"user_id"`
-	UserName string `json:"user_name"`
+	UserID    int64  `json:"user_id"`
+	UserName  string `json:"user_name"`
+	Referrals int    `json:"referrals"` //邀请参与且具备抽奖资格的人数
+	Entries   int    `json:"entries"`   //抽奖次数，即加权抽奖时的权重，开奖时计算并保存
+}
+
+// Participation 用户在某个活动中的参与记录
+type Participation struct {
+	JoinedAt         string `json:"joined_at"`         //参与时间（UTC），旧版本的记录为空
+	Position         int    `json:"position"`          //按参与时间排序的参与顺序，从1开始
+	Eligible         bool   `json:"eligible"`          //是否具备抽奖资格
+	IneligibleReason string `json:"ineligible_reason"` //失去抽奖资格的原因
+	Referrals        int    `json:"referrals"`         //邀请参与且具备抽奖资格的人数
+	Entries          int    `json:"entries"`           //开奖时记录的抽奖次数，未开奖时为0
 }
 
 // LuckyUser 中奖者名单
 type LuckyUser struct {
-	UserID    int64  `json:"user_id"`
-	UserName  string `json:"user_name"`
-	PrizeInfo string `json:"prize_info"`
+	ID                int64  `json:"id"`
+	UserID            int64  `json:"user_id"`
+	UserName          string `json:"user_name"`
+	PrizeInfo         string `json:"prize_info"`
+	EventID           string `json:"event_id"`
+	TierIndex         int    `json:"tier_index"`
+	TierName          string `json:"tier_name"`
+	ClaimStatus       string `json:"claim_status"`       //领取状态，为空表示无需领取
+	ClaimDeadline     string `json:"claim_deadline"`     //领取期限（UTC）
+	AlternatePosition int    `json:"alternate_position"` //递补中奖者的候补顺序，开奖时抽出的中奖者为0
+	DeliveryStatus    string `json:"delivery_status"`    //中奖通知的送达状态，为空表示旧版本的记录
+	DeliveryError     string `json:"delivery_error"`     //中奖通知发送失败的原因
+}
+
+// 中奖者的领取状态
+const (
+	claimStatusPending = "pending" // 待领取
+	claimStatusClaimed = "claimed" // 已领取
+	claimStatusExpired = "expired" // 逾期未领取，奖品已由候补递补或退回库存
+)
+
+// 中奖通知的送达状态
+const (
+	deliveryStatusPending   = "pending"   // 待发送
+	deliveryStatusDelivered = "delivered" // 已送达
+	deliveryStatusFailed    = "failed"    // 发送失败，例如中奖者从未私聊过机器人
+)
+
+// Alternate 候补中奖者
+type Alternate struct {
+	EventID  string `json:"event_id"`
+	Position int    `json:"position"` //候补顺序，从1开始
+	UserID   int64  `json:"user_id"`
+	UserName string `json:"user_name"`
+	Promoted bool   `json:"promoted"` //是否已递补为中奖者
+}
+
+// 奖品状态
+const (
+	prizeStatusAvailable = "available" // 库存中，可被活动选用
+	prizeStatusReserved  = "reserved"  // 已被活动预留，等待开奖
+	prizeStatusAwarded   = "awarded"   // 已发放给中奖者
+)
+
+// Prize 奖品库存
+type Prize struct {
+	ID        int64  `json:"id"`
+	Text      string `json:"text"`
+	Status    string `json:"status"`
 	EventID   string `json:"event_id"`
+	Pool      string `json:"pool"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Admin 管理员
+type Admin struct {
+	UserID    int64  `json:"user_id"`
+	Role      string `json:"role"`
+	AddedBy   int64  `json:"added_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Ban 禁止参与的记录
+type Ban struct {
+	UserID    int64  `json:"user_id"`
+	EventID   string `json:"event_id"`   // 为空表示禁止参与所有活动
+	Reason    string `json:"reason"`     // 禁止参与的原因
+	ExpiresAt string `json:"expires_at"` // 到期时间（UTC），为空表示永久禁止
+	BannedBy  int64  `json:"banned_by"`
+	CreatedAt string `json:"created_at"`
 }
 
 // winInfo 中奖信息
@@ -65,6 +200,9 @@ type winInfo struct {
 	PrizeCount        int    `json:"prizeCount"`        //奖品数量
 	NumberOfWinners   int    `json:"numberOfWinners"`   //开奖人数
 	PrizeInfo         string `json:"prizeInfo"`         //奖品
+	TierName          string `json:"tierName"`          //奖项名称
+	ClaimStatus       string `json:"claimStatus"`       //领取状态
+	ClaimDeadline     string `json:"claimDeadline"`     //领取期限（UTC）
 }
 
 func readConfig() {
@@ -81,4 +219,10 @@ func readConfig() {
 	if config.TimeZone == "" {
 		config.TimeZone = "UTC"
 	}
+	if config.GroupAdminRole == "" {
+		config.GroupAdminRole = roleEventManager
+	}
+	if config.Webhook.Path == "" {
+		config.Webhook.Path = "/"
+	}
 }
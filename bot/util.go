@@ -1,23 +1,14 @@
 package bot
 
 import (
-	"bufio"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"log"
-	"os"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 )
 
-func (b *Bot) checkAdmin(msg *tgbotapi.Message) bool {
-	if msg.From.ID != config.AdminUserID {
-		return false
-	}
-	return true
-}
-
 func (b *Bot) send(msg *tgbotapi.Message, text string) error {
 	message := tgbotapi.NewMessage(msg.Chat.ID, text)
 	_, err := b.Bot.Send(message)
@@ -92,218 +83,15 @@ func CheckTime(inputTime string) error {
 	return nil
 }
 
-// 加载奖品信息，并去除空白行
-func loadPrizes() ([]string, error) {
-
-	// 打开奖品文件
-	file, err := os.Open(config.PrizeTxtFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("open file error: %v", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("prizes file close error: %v", err)
-		}
-	}()
-
-	var prizes []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			prizes = append(prizes, line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scanning file error: %v", err)
-	}
-
-	return prizes, nil
-}
-
-// ReplaceUnChoosePrizes 删除已经选择的奖品
-func ReplaceUnChoosePrizes(allPrizes []string, choosePrizes []string) error {
-	// 创建一个 map 来存储已选择的奖品
-	selectedMap := make(map[string]bool)
-	for _, prize := range choosePrizes {
-		selectedMap[prize] = true
-	}
-
-	// 创建一个切片存储未选择的奖品
-	var unselectedPrizes []string
-	for _, prize := range allPrizes {
-		if !selectedMap[prize] {
-			unselectedPrizes = append(unselectedPrizes, prize)
-		}
-	}
-	// 打开文件以写入（覆盖模式）
-	file, err := os.Create(config.PrizeTxtFilePath)
-	if err != nil {
-		return fmt.Errorf("无法打开文件: %v", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Fatalf("failed to close prize TXT file: %v", err)
-		}
-	}()
-
-	// 使用缓冲写入以提高写入性能
-	writer := bufio.NewWriter(file)
-	for _, prize := range unselectedPrizes {
-		_, err := writer.WriteString(prize + "\n")
-		if err != nil {
-			return fmt.Errorf("写入文件失败: %v", err)
-		}
-	}
-
-	// 确保所有缓冲区内容写入文件
-	err = writer.Flush()
-	if err != nil {
-		return fmt.Errorf("刷新缓冲区失败: %v", err)
-	}
-
-	return nil
-}
-
-// 添加奖品到txt
-func addPrizesToPrizeTxtFile(prizes []string) error {
-	// 打开文件进行读写操作
-	file, err := os.OpenFile(config.PrizeTxtFilePath, os.O_RDWR, 0644)
-	if err != nil {
-		return fmt.Errorf("open file error: %v", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("failed to close prize TXT file: %v", err)
-		}
-	}()
-
-	// 创建一个切片来存储所有非空白行
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("reading file error: %v", err)
-	}
-
-	// 将奖品列表添加到文件的最后
-	lines = append(lines, prizes...)
-
-	// 清空文件内容并将所有行写回文件
-	err = file.Truncate(0) // 清空文件
-	if err != nil {
-		return fmt.Errorf("truncate file error: %v", err)
-	}
-	_, err = file.Seek(0, 0) // 重置文件指针
-	if err != nil {
-		return fmt.Errorf("seek file error: %v", err)
-	}
-
-	writer := bufio.NewWriter(file)
-	for _, line := range lines {
-		_, err := writer.WriteString(line + "\n")
-		if err != nil {
-			return fmt.Errorf("writing to file error: %v", err)
-		}
-	}
-	err = writer.Flush()
-	if err != nil {
-		return fmt.Errorf("flush writer error: %v", err)
-	}
-
-	return nil
-}
-
-// 删除奖品txt中的奖品
-func removePrizesFromPrizeTxtFile(prizesToRemove []string) error {
-	// 打开文件进行读写操作
-	file, err := os.OpenFile(config.PrizeTxtFilePath, os.O_RDWR, 0644)
-	if err != nil {
-		return fmt.Errorf("open file error: %v", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("failed to close prize TXT file: %v", err)
-		}
-	}()
-
-	// 读取文件内容
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			lines = append(lines, line)
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("reading file error: %v", err)
-	}
-
-	// 创建一个map来快速查找需要删除的奖品
-	toRemove := make(map[string]struct{})
-	for _, prize := range prizesToRemove {
-		toRemove[strings.TrimSpace(prize)] = struct{}{}
-	}
-
-	// 保留不在删除列表中的奖品
-	var updatedLines []string
-	for _, line := range lines {
-		if _, found := toRemove[line]; !found {
-			updatedLines = append(updatedLines, line)
-		}
-	}
-
-	// 清空文件内容并将更新后的内容写回文件
-	err = file.Truncate(0) // 清空文件
-	if err != nil {
-		return fmt.Errorf("truncate file error: %v", err)
-	}
-	_, err = file.Seek(0, 0) // 重置文件指针
-	if err != nil {
-		return fmt.Errorf("seek file error: %v", err)
-	}
-
-	writer := bufio.NewWriter(file)
-	for _, line := range updatedLines {
-		_, err := writer.WriteString(line + "\n")
-		if err != nil {
-			return fmt.Errorf("writing to file error: %v", err)
-		}
-	}
-	err = writer.Flush()
-	if err != nil {
-		return fmt.Errorf("flush writer error: %v", err)
-	}
-
-	return nil
-}
-
-func createAllEventInfoMsg(info EventInformation) (outputMsg string, err error) {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		return "", fmt.Errorf("init DB error: %v", err)
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("failed to close DB: %v", err)
-		}
-	}()
+func (b *Bot) createAllEventInfoMsg(info EventInformation) (outputMsg string, err error) {
 	// 获取中奖者用户名
-	LuckyUserStr, err := getAllLuckyUserName(db, info.ID)
+	LuckyUserStr, err := getAllLuckyUserName(b.store, info.ID)
 	if err != nil {
 		return "", fmt.Errorf("get all lucky user name error: %v", err)
 	}
 
 	// 检查参与人数
-	NumberOfParticipants, err := getParticipantCountByEventID(db, info.ID)
+	NumberOfParticipants, err := b.store.CountParticipants(info.ID)
 	if err != nil {
 		return "", fmt.Errorf("get number of participants error: %v", err)
 	}
@@ -317,7 +105,14 @@ func createAllEventInfoMsg(info EventInformation) (outputMsg string, err error)
 		outputMsg += fmt.Sprintf("<b>开奖时间:</b> <code>%v</code> %v\n<b>参与人数:</b> %v\n", info.TimeOfWinners, config.TimeZone, NumberOfParticipants)
 	} else if info.PrizeResultMethod == "2" {
 		outputMsg += fmt.Sprintf("<b>开奖人数:</b> %v\n<b>参与人数:</b> %v\n", info.NumberOfWinners, NumberOfParticipants)
+	} else if info.PrizeResultMethod == "3" {
+		outputMsg += fmt.Sprintf("<b>开奖时间:</b> <code>%v</code> %v\n<b>开奖人数:</b> %v\n<b>参与人数:</b> %v\n",
+			info.TimeOfWinners, config.TimeZone, info.NumberOfWinners, NumberOfParticipants)
 	}
+	outputMsg += formatMinParticipantsHTML(info)
+	outputMsg += formatClaimRuleHTML(info)
+	outputMsg += formatEntryRulesHTML(info)
+	outputMsg += formatCooldownRuleHTML(info)
 
 	if info.HowToParticipate == "1" {
 		outputMsg += fmt.Sprintf("<b>抽奖关键词:</b> %v\n", info.KeyWord)
@@ -335,25 +130,15 @@ func createAllEventInfoMsg(info EventInformation) (outputMsg string, err error)
 	return outputMsg, nil
 }
 
-func createUserSeeEventInfoMsg(info EventInformation) (outputMsg string, err error) {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		return "", fmt.Errorf("init DB error: %v", err)
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("failed to close DB: %v", err)
-		}
-	}()
+func (b *Bot) createUserSeeEventInfoMsg(info EventInformation) (outputMsg string, err error) {
 	// 获取中奖者用户名
-	LuckyUserStr, err := getAllLuckyUserName(db, info.ID)
+	LuckyUserStr, err := getAllLuckyUserName(b.store, info.ID)
 	if err != nil {
 		return "", fmt.Errorf("get all lucky user name error: %v", err)
 	}
 
 	// 检查参与人数
-	NumberOfParticipants, err := getParticipantCountByEventID(db, info.ID)
+	NumberOfParticipants, err := b.store.CountParticipants(info.ID)
 	if err != nil {
 		return "", fmt.Errorf("get number of participants error: %v", err)
 	}
@@ -367,7 +152,14 @@ func createUserSeeEventInfoMsg(info EventInformation) (outputMsg string, err err
 		outputMsg += fmt.Sprintf("<b>开奖时间:</b> <code>%v</code> %v\n<b>参与人数:</b> %v\n", info.TimeOfWinners, config.TimeZone, NumberOfParticipants)
 	} else if info.PrizeResultMethod == "2" {
 		outputMsg += fmt.Sprintf("<b>开奖人数:</b> %v\n<b>参与人数:</b> %v\n", info.NumberOfWinners, NumberOfParticipants)
+	} else if info.PrizeResultMethod == "3" {
+		outputMsg += fmt.Sprintf("<b>开奖时间:</b> <code>%v</code> %v\n<b>开奖人数:</b> %v\n<b>参与人数:</b> %v\n",
+			info.TimeOfWinners, config.TimeZone, info.NumberOfWinners, NumberOfParticipants)
 	}
+	outputMsg += formatMinParticipantsHTML(info)
+	outputMsg += formatClaimRuleHTML(info)
+	outputMsg += formatEntryRulesHTML(info)
+	outputMsg += formatCooldownRuleHTML(info)
 
 	if info.HowToParticipate == "1" {
 		outputMsg += fmt.Sprintf("<b>抽奖关键词:</b> %v\n", info.KeyWord)
@@ -385,48 +177,32 @@ func createUserSeeEventInfoMsg(info EventInformation) (outputMsg string, err err
 	return outputMsg, nil
 }
 
-func (b *Bot) sendPrizeToUser(eventID string, luckyUserList []LuckyUser) error {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
-		return err
-	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
-		}
-	}()
-
+// 私聊通知所有中奖者并记录送达状态，返回未能送达的中奖者
+func (b *Bot) sendPrizeToUser(eventID string, luckyUserList []LuckyUser) ([]LuckyUser, error) {
 	// 获取活动信息
-	eventInfo, err := checkEventInformationFromId(db, eventID)
+	eventInfo, err := b.store.GetEvent(eventID)
 	if err != nil {
-		log.Printf("checkCreateInformation ERROR %v\n", err)
-		return err
+		log.Printf("GetEvent ERROR %v\n", err)
+		return nil, err
 	}
-	var wg sync.WaitGroup
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		undelivered []LuckyUser
+	)
 
 	for _, luckyUser := range luckyUserList {
 		wg.Add(1)
 		go func(user LuckyUser) {
 			defer wg.Done()
 
-			// 构建消息内容，使用Markdown格式
-			msgText := fmt.Sprintf(
-				"🎉 恭喜你中奖了！\n"+
-					"活动ID: %s\n"+
-					"群名称: %s\n"+
-					"活动名称: %s\n"+
-					"奖品: %v",
-				eventID, eventInfo.GroupName, eventInfo.PrizeName, user.PrizeInfo,
-			)
-
-			// 创建消息对象并指定接收者的ChatID
-			message := tgbotapi.NewMessage(user.UserID, msgText)
-			// 发送消息
-			_, err := b.Bot.Send(message)
+			// 发送中奖通知，需要领取的奖品附带领取按钮
+			err := b.deliverWinnerNotice(eventInfo, user)
 			if err != nil {
 				log.Printf("无法发送消息给用户 %d: %v", user.UserID, err)
+				mu.Lock()
+				undelivered = append(undelivered, user)
+				mu.Unlock()
 			} else {
 				log.Printf("成功发送中奖消息给用户 %s (ID: %d)", user.UserName, user.UserID)
 			}
@@ -434,29 +210,31 @@ func (b *Bot) sendPrizeToUser(eventID string, luckyUserList []LuckyUser) error {
 	}
 
 	wg.Wait() // 等待所有Goroutines完成
-	return nil
+	// 按中奖顺序排列，与中奖者名单一致
+	sort.Slice(undelivered, func(i, j int) bool {
+		return undelivered[i].ID < undelivered[j].ID
+	})
+	return undelivered, nil
 }
 
-func (b *Bot) sendPrizeDrawMsgToGroup(eventInfo EventInformation) error {
-	// 初始化数据库
-	db, err := initDB()
-	if err != nil {
-		log.Printf("无法连接到数据库: %v", err)
-		return err
+// 参与人数少于奖品数量时，说明未抽出的奖品数量
+func formatUnclaimedPrizes(eventInfo EventInformation, winnerCount int) string {
+	unclaimed := eventInfo.PrizeCount - winnerCount
+	if unclaimed <= 0 {
+		return ""
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			log.Printf("关闭数据库连接失败: %v", err)
-		}
-	}()
+	return fmt.Sprintf("参与人数少于奖品数量，%d 个奖品未抽出，已退回库存\n", unclaimed)
+}
+
+func (b *Bot) sendPrizeDrawMsgToGroup(eventInfo EventInformation, luckyUsers []LuckyUser, undelivered []LuckyUser) error {
 	// 获取中奖者用户名
-	userNameStr, err := getAllLuckyUserName(db, eventInfo.ID)
+	userNameStr, err := getAllLuckyUserName(b.store, eventInfo.ID)
 	if err != nil {
 		log.Printf("getAllLuckyUserName error: %v", err)
 		return err
 	}
 	// 获取参与人数
-	NumberOfParticipants, err := getParticipantCountByEventID(db, eventInfo.ID)
+	NumberOfParticipants, err := b.store.CountParticipants(eventInfo.ID)
 	if err != nil {
 		log.Printf(err.Error())
 	}
@@ -464,42 +242,25 @@ func (b *Bot) sendPrizeDrawMsgToGroup(eventInfo EventInformation) error {
 	if eventInfo.Participate == "群组内发送关键词" {
 		prizeDrawMsg += fmt.Sprintf("关键词：%s\n", eventInfo.KeyWord)
 	}
-	if eventInfo.PrizeResult == "按人数开奖" {
+	if eventInfo.PrizeResultMethod == "2" {
 		prizeDrawMsg += fmt.Sprintf("开奖人数：%d\n参与人数：%d\n", eventInfo.NumberOfWinners, NumberOfParticipants)
-	} else if eventInfo.PrizeResult == "按时间开奖" {
+	} else if eventInfo.PrizeResultMethod == "1" {
 		prizeDrawMsg += fmt.Sprintf("开奖时间：%s %v\n参与人数：%d\n", eventInfo.TimeOfWinners, config.TimeZone, NumberOfParticipants)
+	} else if eventInfo.PrizeResultMethod == "3" {
+		prizeDrawMsg += fmt.Sprintf("开奖时间：%s %v\n开奖人数：%d\n参与人数：%d\n",
+			eventInfo.TimeOfWinners, config.TimeZone, eventInfo.NumberOfWinners, NumberOfParticipants)
 	}
-	err = b.sendMsgToGroup(prizeDrawMsg)
-	if err != nil {
-		log.Printf("sendMsgToGroup err %v\n", err)
-		return err
-	}
-	return nil
-}
-
-func (b *Bot) sendMsgToGroup(text string) error {
-	// 发送消息到指定群组
-	chatID := tgbotapi.ChatConfigWithUser{
-		ChatID:             0,
-		SuperGroupUsername: config.GroupUserName,
+	prizeDrawMsg += formatUnclaimedPrizes(eventInfo, len(luckyUsers))
+	if eventInfo.ClaimHours > 0 {
+		prizeDrawMsg += fmt.Sprintf("中奖者请在 %d 小时内私聊机器人点击领取，逾期未领取由候补递补\n", eventInfo.ClaimHours)
 	}
-
-	message := tgbotapi.NewMessageToChannel(chatID.SuperGroupUsername, text)
-	message.ParseMode = tgbotapi.ModeHTML
-
-	_, err := b.Bot.Send(message)
+	prizeDrawMsg += b.formatUndeliveredHTML(eventInfo.ID, undelivered)
+	prizeDrawMsg += fmt.Sprintf("开奖种子：<code>%s</code>\n种子承诺：<code>%s</code>\n验证指令：<code>/verify %s</code>\n",
+		eventInfo.Seed, eventInfo.SeedCommitment, eventInfo.ID)
+	err = b.sendMsgToEventGroup(eventInfo, prizeDrawMsg)
 	if err != nil {
-		log.Printf("sendMsgToGroup err %v\n", err)
+		log.Printf("sendMsgToEventGroup err %v\n", err)
 		return err
 	}
 	return nil
 }
-
-func (b *Bot) getGroupInfo() (chat tgbotapi.Chat, err error) {
-	chatConfig := tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{SuperGroupUsername: config.GroupUserName}}
-	chat, err = b.Bot.GetChat(chatConfig)
-	if err != nil {
-		log.Panic(err)
-	}
-	return chat, nil
-}
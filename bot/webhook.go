@@ -0,0 +1,97 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"log"
+	"net/http"
+)
+
+// 向 Telegram 注册 webhook，并附带用于校验请求来源的密钥
+func (b *Bot) setWebhook() error {
+	params := make(tgbotapi.Params)
+	params["url"] = config.Webhook.URL
+	params["secret_token"] = config.Webhook.SecretToken
+	_, err := b.Bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		return fmt.Errorf("setWebhook error: %v", err)
+	}
+	return nil
+}
+
+// 校验请求头中的密钥，未配置密钥时拒绝所有请求
+func checkWebhookSecret(r *http.Request) bool {
+	if config.Webhook.SecretToken == "" {
+		return false
+	}
+	token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.Webhook.SecretToken)) == 1
+}
+
+// 处理 Telegram 推送的更新，校验通过后放入更新队列
+func (b *Bot) webhookHandler(updates chan<- tgbotapi.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !checkWebhookSecret(r) {
+			log.Printf("webhook request from %s rejected: invalid secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		update, err := b.Bot.HandleUpdate(r)
+		if err != nil {
+			log.Printf("webhook decode update error: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// 停止后不再接收更新，Telegram 会稍后重新推送
+		select {
+		case updates <- *update:
+			w.WriteHeader(http.StatusOK)
+		case <-b.stopCh:
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// 注册 webhook 并启动内置 HTTP 服务，返回的更新队列与长轮询的使用方式相同
+func (b *Bot) startWebhook() (tgbotapi.UpdatesChannel, error) {
+	if config.Webhook.URL == "" || config.Webhook.Listen == "" {
+		return nil, fmt.Errorf("webhook 模式需要配置 url 和 listen")
+	}
+	// 没有密钥时任何知道地址的人都可以伪造更新
+	if config.Webhook.SecretToken == "" {
+		return nil, fmt.Errorf("webhook 模式需要配置 secret_token")
+	}
+
+	err := b.setWebhook()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan tgbotapi.Update, b.Bot.Buffer)
+	mux := http.NewServeMux()
+	mux.Handle(config.Webhook.Path, b.webhookHandler(updates))
+
+	// 与 Stop 在同一把锁下读写 webhookServer，已经开始停止时不再启动服务
+	server := &http.Server{Addr: config.Webhook.Listen, Handler: mux}
+	b.stopMu.Lock()
+	if b.stopping {
+		b.stopMu.Unlock()
+		return nil, errBotStopping
+	}
+	b.webhookServer = server
+	b.stopMu.Unlock()
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("webhook server error: %v", err)
+		}
+	}()
+	log.Printf("webhook 已启动，监听 %s%s", config.Webhook.Listen, config.Webhook.Path)
+	return updates, nil
+}
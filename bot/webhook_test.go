@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// 本地模拟的 Telegram Bot API，记录收到的方法和参数
+type fakeTelegram struct {
+	mu     sync.Mutex
+	calls  map[string][]map[string]string
+	server *httptest.Server
+}
+
+func newFakeTelegram(t *testing.T) *fakeTelegram {
+	t.Helper()
+	fake := &fakeTelegram{calls: make(map[string][]map[string]string)}
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		params := make(map[string]string)
+		for key := range r.PostForm {
+			params[key] = r.PostForm.Get(key)
+		}
+		fake.mu.Lock()
+		fake.calls[method] = append(fake.calls[method], params)
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if method == "getMe" {
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"b","username":"testbot"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (f *fakeTelegram) called(method string) []map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// 使用 api_endpoint 指向本地模拟服务器创建机器人
+func newWebhookTestBot(t *testing.T, fake *fakeTelegram) *Bot {
+	t.Helper()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("TOKEN", fake.server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("NewBotAPIWithAPIEndpoint: %v", err)
+	}
+	return &Bot{Bot: api, stopCh: make(chan struct{})}
+}
+
+func setWebhookConfig(t *testing.T, webhook WebhookConfig) {
+	t.Helper()
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.Webhook = webhook
+}
+
+func TestAPIEndpointOverride(t *testing.T) {
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+
+	if len(fake.called("getMe")) != 1 {
+		t.Fatalf("getMe was not sent to the fake server")
+	}
+	if b.Bot.Self.UserName != "testbot" {
+		t.Errorf("Self.UserName = %q, want testbot", b.Bot.Self.UserName)
+	}
+}
+
+func TestSetWebhookSendsSecret(t *testing.T) {
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+	setWebhookConfig(t, WebhookConfig{Enabled: true, URL: "https://example.com/hook", SecretToken: "s3cret"})
+
+	if err := b.setWebhook(); err != nil {
+		t.Fatalf("setWebhook: %v", err)
+	}
+	calls := fake.called("setWebhook")
+	if len(calls) != 1 {
+		t.Fatalf("setWebhook calls = %d, want 1", len(calls))
+	}
+	if calls[0]["url"] != "https://example.com/hook" || calls[0]["secret_token"] != "s3cret" {
+		t.Errorf("setWebhook params = %v", calls[0])
+	}
+}
+
+func TestStartWebhookRequiresSecret(t *testing.T) {
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+	setWebhookConfig(t, WebhookConfig{Enabled: true, URL: "https://example.com/hook", Listen: "127.0.0.1:0", Path: "/hook"})
+
+	if _, err := b.startWebhook(); err == nil {
+		t.Fatal("startWebhook without secret_token succeeded")
+	}
+	if len(fake.called("setWebhook")) != 0 {
+		t.Error("webhook was registered without secret_token")
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	const body = `{"update_id":7,"message":{"message_id":1,"date":0,"text":"hi","chat":{"id":5,"type":"private"}}}`
+	tests := []struct {
+		name       string
+		secret     string
+		method     string
+		header     string
+		wantStatus int
+		wantUpdate bool
+	}{
+		{name: "valid secret", secret: "s3cret", method: http.MethodPost, header: "s3cret", wantStatus: http.StatusOK, wantUpdate: true},
+		{name: "missing header", secret: "s3cret", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "wrong secret", secret: "s3cret", method: http.MethodPost, header: "guess", wantStatus: http.StatusForbidden},
+		{name: "no secret configured", secret: "", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "wrong method", secret: "s3cret", method: http.MethodGet, header: "s3cret", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setWebhookConfig(t, WebhookConfig{Enabled: true, SecretToken: tt.secret})
+			updates := make(chan tgbotapi.Update, 1)
+
+			req := httptest.NewRequest(tt.method, "/hook", strings.NewReader(body))
+			if tt.header != "" {
+				req.Header.Set("X-Telegram-Bot-Api-Secret-Token", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			b.webhookHandler(updates).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			select {
+			case update := <-updates:
+				if !tt.wantUpdate {
+					t.Errorf("unexpected update %d", update.UpdateID)
+				} else if update.UpdateID != 7 || update.Message.Text != "hi" {
+					t.Errorf("update = %+v", update)
+				}
+			default:
+				if tt.wantUpdate {
+					t.Error("update was not queued")
+				}
+			}
+		})
+	}
+}
+
+// 已经开始停止时不再启动 webhook 服务，避免 Stop 之后仍有服务在监听
+func TestStartWebhookAfterStop(t *testing.T) {
+	fake := newFakeTelegram(t)
+	b := newWebhookTestBot(t, fake)
+	setWebhookConfig(t, WebhookConfig{Enabled: true, URL: "https://example.com/hook", Listen: "127.0.0.1:0", Path: "/hook", SecretToken: "s3cret"})
+	b.stopping = true
+
+	if _, err := b.startWebhook(); !errors.Is(err, errBotStopping) {
+		t.Fatalf("startWebhook err = %v, want errBotStopping", err)
+	}
+	if b.webhookServer != nil {
+		t.Error("webhook server was created after Stop")
+	}
+}
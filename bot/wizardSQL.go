@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// 保存用户的创建活动向导状态
+func (s *sqliteStore) SaveWizardState(userID int64, state string, info EventInformation) error {
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("error marshalling event info: %v", err)
+	}
+
+	_, err = s.db.Exec(`
+	INSERT INTO wizard_states (user_id, state, event_info, updated_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET
+		state=excluded.state, event_info=excluded.event_info, updated_at=excluded.updated_at
+	`, userID, state, string(infoJSON))
+	if err != nil {
+		return fmt.Errorf("error saving wizard state: %v", err)
+	}
+	return nil
+}
+
+// 删除用户的创建活动向导状态
+func (s *sqliteStore) DeleteWizardState(userID int64) error {
+	_, err := s.db.Exec("DELETE FROM wizard_states WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting wizard state: %v", err)
+	}
+	return nil
+}
+
+// 加载所有未完成的创建活动向导状态
+func (s *sqliteStore) LoadWizardStates() (states map[int64]string, infos map[int64]EventInformation, err error) {
+	rows, err := s.db.Query("SELECT user_id, state, event_info FROM wizard_states")
+	if err != nil {
+		return nil, nil, fmt.Errorf("LoadWizardStates ERROR: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close ERROR: %v", err)
+		}
+	}()
+
+	states = make(map[int64]string)
+	infos = make(map[int64]EventInformation)
+	for rows.Next() {
+		var userID int64
+		var state, infoJSON string
+		if err = rows.Scan(&userID, &state, &infoJSON); err != nil {
+			return nil, nil, fmt.Errorf("scan wizard states ERROR: %v", err)
+		}
+		var info EventInformation
+		if err = json.Unmarshal([]byte(infoJSON), &info); err != nil {
+			return nil, nil, fmt.Errorf("json unmarshal event info ERROR: %v", err)
+		}
+		states[userID] = state
+		infos[userID] = info
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("LoadWizardStates ERROR: %v", err)
+	}
+	return states, infos, nil
+}
@@ -10,6 +10,14 @@ import (
 )
 
 func main() {
+	// Database migrations: TgLotteryBot migrate status|up
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bot.RunMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Error running migrations: %v", err)
+		}
+		return
+	}
+
 	// Initialize the bot
 	botInstance, err := bot.NewBot()
 	if err != nil {